@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"goutils/gelf"
+)
+
+// levelPrefix matches levels at the start of a line, e.g. "ERROR ...", "[warn] ..." or "2023-04-05 10:00:00 INFO ...".
+// Only a date and a time may come before the level, so "No error found" keeps the default level.
+var levelPrefix = regexp.MustCompile(`(?i)^(?:\[?\d[\d/:.,T+\-Z]*\]?\s+){0,2}[\[<(]?(debug|info|warn|warning|error|err|fatal|crit|critical|panic)[\]>):]?(?:\s|$)`)
+
+// levelAliases maps the detected words to levels, crit is PANIC because GELF sends PANIC as
+// syslog Critical and FATAL as Alert.
+var levelAliases = map[string]gelf.LogLevel{
+	"debug":    gelf.DEBUG,
+	"info":     gelf.INFO,
+	"warn":     gelf.WARN,
+	"warning":  gelf.WARN,
+	"error":    gelf.ERROR,
+	"err":      gelf.ERROR,
+	"crit":     gelf.PANIC,
+	"critical": gelf.PANIC,
+	"fatal":    gelf.FATAL,
+	"panic":    gelf.PANIC,
+}
+
+// messageKeys are the JSON keys used as the GELF short_message, in order of preference.
+var messageKeys = []string{"msg", "message", "short_message"}
+
+// parseLine returns the level, message and key/value fields of a line.
+func parseLine(line string, defaultLevel gelf.LogLevel, detectLevel, jsonLines bool) (gelf.LogLevel, string, []interface{}) {
+	if jsonLines {
+		if level, msg, fields, ok := parseJSONLine(line, defaultLevel); ok {
+			return level, msg, fields
+		}
+	}
+	if detectLevel {
+		if match := levelPrefix.FindStringSubmatch(line); match != nil {
+			return levelAliases[strings.ToLower(match[1])], line, nil
+		}
+	}
+	return defaultLevel, line, nil
+}
+
+func parseJSONLine(line string, defaultLevel gelf.LogLevel) (gelf.LogLevel, string, []interface{}, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "{") {
+		return defaultLevel, "", nil, false
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(trimmed), &object); err != nil {
+		return defaultLevel, "", nil, false
+	}
+	msg := line
+	for _, key := range messageKeys {
+		if value, ok := object[key]; ok {
+			msg = fmt.Sprint(value)
+			delete(object, key)
+			break
+		}
+	}
+	level := defaultLevel
+	if value, ok := object["level"].(string); ok {
+		if parsed, ok := levelAliases[strings.ToLower(value)]; ok {
+			level = parsed
+			delete(object, "level")
+		}
+	}
+	fields := make([]interface{}, 0, len(object)*2)
+	for key, value := range object {
+		fields = append(fields, key, value)
+	}
+	return level, msg, fields, true
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"goutils/gelf"
+)
+
+func TestParseLineLevel(t *testing.T) {
+	tests := map[string]gelf.LogLevel{
+		"ERROR disk full":                            gelf.ERROR,
+		"[warn] retrying":                            gelf.WARN,
+		"2023-04-05 10:00:00 DEBUG cache miss":       gelf.DEBUG,
+		"<critical> raid degraded":                   gelf.PANIC,
+		"backup finished, no errors":                 gelf.INFO,
+		"2023/04/05 10:00:00 warning: slow response": gelf.WARN,
+		"2023-04-05T10:00:00.123Z error: timeout":    gelf.ERROR,
+		"[2023-04-05 10:00:00] info started":         gelf.INFO,
+	}
+	for line, expected := range tests {
+		level, msg, fields := parseLine(line, gelf.INFO, true, false)
+		if level != expected || msg != line || fields != nil {
+			t.Errorf("%q: expected %v, got %v", line, expected, level)
+		}
+	}
+	// Level words after other words are part of the message
+	for _, line := range []string{"No error found", "user info updated", "job fatal? no", "disk warn threshold 90%"} {
+		if level, _, _ := parseLine(line, gelf.DEBUG, true, false); level != gelf.DEBUG {
+			t.Errorf("%q: expected the default level, got %v", line, level)
+		}
+	}
+	if level, _, _ := parseLine("ERROR disk full", gelf.INFO, false, false); level != gelf.INFO {
+		t.Error("level detection must be optional")
+	}
+}
+
+func TestParseJSONLine(t *testing.T) {
+	level, msg, fields := parseLine(`{"level":"error","msg":"timeout","user":"tom"}`, gelf.INFO, true, true)
+	if level != gelf.ERROR || msg != "timeout" || fmt.Sprint(fields) != "[user tom]" {
+		t.Errorf("unexpected result %v %q %v", level, msg, fields)
+	}
+	level, msg, fields = parseLine(`{not json`, gelf.INFO, true, true)
+	if level != gelf.INFO || msg != "{not json" || fields != nil {
+		t.Errorf("invalid JSON must be forwarded as text, got %v %q %v", level, msg, fields)
+	}
+}
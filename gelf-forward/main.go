@@ -0,0 +1,216 @@
+// gelf-forward reads lines from stdin or follows files and ships every line to Graylog as a GELF message.
+//
+//	some-cron-job 2>&1 | gelf-forward --host graylog --port 12201 -f job=backup
+//	gelf-forward --transport tcp --json /var/log/legacy/app.log
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"goutils/gelf"
+)
+
+const (
+	maxLineSize  = 1 << 20
+	closeTimeout = 5 * time.Second
+)
+
+// fieldFlags collects repeated -f key=value flags.
+type fieldFlags []string
+
+func (f *fieldFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fieldFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("field %q is not key=value", value)
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+type options struct {
+	host         string
+	port         int
+	transport    string
+	compress     string
+	level        gelf.LogLevel
+	detectLevel  bool
+	jsonLines    bool
+	fromStart    bool
+	pollInterval time.Duration
+	fields       fieldFlags
+}
+
+func main() {
+	opts := options{}
+	var level string
+	flag.StringVar(&opts.host, "host", "127.0.0.1", "Graylog host")
+	flag.IntVar(&opts.port, "port", 12201, "Graylog GELF input port")
+	flag.StringVar(&opts.transport, "transport", "udp", "udp, tcp, tls or http")
+	flag.StringVar(&opts.compress, "compress", "", "gzip or zlib for udp, gzip for http")
+	flag.StringVar(&level, "level", "info", "level of lines without a detected level")
+	flag.BoolVar(&opts.detectLevel, "detect-level", true, "detect the level from prefixes like ERROR or [warn]")
+	flag.BoolVar(&opts.jsonLines, "json", false, "parse JSON object lines into fields")
+	flag.BoolVar(&opts.fromStart, "from-start", false, "read followed files from the beginning instead of the end")
+	flag.DurationVar(&opts.pollInterval, "poll", 250*time.Millisecond, "poll interval for followed files")
+	flag.Var(&opts.fields, "f", "extra key=value field, may be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file ...]\n\nReads stdin when no file is given, files are followed like tail -F.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	if opts.level, err = gelf.ParseLevel(level); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	handler, err := newHandler(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	log := gelf.New("gelf-forward")
+	log.AddHandlers(handler)
+	// The records describe the forwarded program, not this one
+	log = log.With(fieldArgs(opts.fields)...).WithoutCaller()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	lines := make(chan string)
+	var wg sync.WaitGroup
+	if flag.NArg() == 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readLines(ctx, os.Stdin, lines)
+		}()
+	}
+	for _, path := range flag.Args() {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			follow(ctx, path, opts.fromStart, opts.pollInterval, lines)
+		}(path)
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	forwardLines(ctx, log, opts, lines)
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer closeCancel()
+	if err := log.Flush(closeCtx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	_ = log.Close()
+}
+
+func newHandler(opts options) (gelf.LogHandler, error) {
+	if opts.transport == "http" {
+		url := fmt.Sprintf("http://%v:%v/gelf", opts.host, opts.port)
+		var httpOpts []gelf.HTTPOption
+		switch opts.compress {
+		case "":
+		case "gzip":
+			httpOpts = append(httpOpts, gelf.WithGzip())
+		default:
+			return nil, fmt.Errorf("compression %q is not supported over http, use gzip", opts.compress)
+		}
+		return gelf.NewGELFHTTPHandler(url, httpOpts...), nil
+	}
+	var gelfOpts []gelf.GELFOption
+	switch opts.transport {
+	case "udp":
+	case "tcp":
+		gelfOpts = append(gelfOpts, gelf.WithTransport(gelf.TransportTCP))
+	case "tls":
+		gelfOpts = append(gelfOpts, gelf.WithTransport(gelf.TransportTLS))
+	default:
+		return nil, fmt.Errorf("unknown transport %q", opts.transport)
+	}
+	switch opts.compress {
+	case "":
+	case "gzip", "zlib":
+		// GELF over TCP does not support compression, the handler would ignore it
+		if opts.transport != "udp" {
+			return nil, fmt.Errorf("compression is not supported over %v", opts.transport)
+		}
+		compression := gelf.CompressGzip
+		if opts.compress == "zlib" {
+			compression = gelf.CompressZlib
+		}
+		gelfOpts = append(gelfOpts, gelf.WithCompression(compression))
+	default:
+		return nil, fmt.Errorf("unknown compression %q", opts.compress)
+	}
+	return gelf.NewGELFHandler(opts.host, opts.port, gelfOpts...), nil
+}
+
+func fieldArgs(fields fieldFlags) []interface{} {
+	var args []interface{}
+	for _, field := range fields {
+		kv := strings.SplitN(field, "=", 2)
+		args = append(args, kv[0], kv[1])
+	}
+	return args
+}
+
+func readLines(ctx context.Context, r io.Reader, lines chan<- string) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		select {
+		case lines <- scanner.Text():
+		case <-ctx.Done():
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "Read stdin error ", err)
+	}
+}
+
+// forwardLines forwards lines until the channel is closed or ctx is cancelled. It does not
+// wait for the readers after cancel, reading stdin blocks until the next line arrives.
+func forwardLines(ctx context.Context, log *gelf.Log, opts options, lines <-chan string) {
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			forward(log, opts, line)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func forward(log *gelf.Log, opts options, line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	level, msg, fields := parseLine(line, opts.level, opts.detectLevel, opts.jsonLines)
+	log.Logw(level, msg, fields...)
+}
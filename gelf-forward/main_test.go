@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"goutils/gelf"
+	"goutils/gelf/gelftest"
+)
+
+func TestForwardLinesCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// Nothing ever closes lines, like an idle stdin reader
+	lines := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		forwardLines(ctx, gelf.New("test"), options{}, lines)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("forwardLines must return after cancel")
+	}
+}
+
+func TestForwardWithoutCaller(t *testing.T) {
+	server, err := gelftest.NewUDPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	handler, err := newHandler(options{host: server.Host(), port: server.Port(), transport: "udp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := gelf.New("gelf-forward")
+	log.AddHandlers(handler)
+	forward(log.WithoutCaller(), options{level: gelf.INFO, detectLevel: true}, "CRITICAL raid degraded")
+	messages, err := server.WaitMessages(1, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := messages[0]
+	// syslog Critical
+	if m.Level != 2 || m.FullMessage != "" {
+		t.Errorf("unexpected message %+v", m)
+	}
+	for _, key := range []string{"_file", "_line", "_function"} {
+		if _, ok := m.Extra[key]; ok {
+			t.Errorf("forwarded line must not carry %v", key)
+		}
+	}
+}
+
+func TestNewHandlerCompression(t *testing.T) {
+	tests := []struct {
+		transport string
+		compress  string
+		valid     bool
+	}{
+		{"udp", "gzip", true},
+		{"udp", "zlib", true},
+		{"http", "gzip", true},
+		{"tcp", "", true},
+		{"tcp", "gzip", false},
+		{"tls", "zlib", false},
+		{"http", "zlib", false},
+		{"http", "brotli", false},
+		{"udp", "brotli", false},
+	}
+	for _, tt := range tests {
+		handler, err := newHandler(options{host: "127.0.0.1", port: 12201, transport: tt.transport, compress: tt.compress})
+		if (err == nil) != tt.valid {
+			t.Errorf("%v %v: unexpected error %v", tt.transport, tt.compress, err)
+		}
+		if c, ok := handler.(interface{ Close() error }); ok {
+			_ = c.Close()
+		}
+	}
+}
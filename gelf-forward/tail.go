@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// tailer follows a file like tail -F, it reopens the path after rotation and seeks back after truncation.
+type tailer struct {
+	path    string
+	file    *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+}
+
+func follow(ctx context.Context, path string, fromStart bool, interval time.Duration, lines chan<- string) {
+	t := &tailer{path: path}
+	defer t.close()
+	// Only the file found at startup may start at its end, files created later are read from the beginning
+	first := true
+	for {
+		if t.file == nil {
+			if err := t.open(first && !fromStart); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintln(os.Stderr, "Open file error ", err)
+			}
+			first = false
+		}
+		if t.file != nil {
+			if !t.readLines(ctx, lines) {
+				return
+			}
+			t.checkRotation()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (t *tailer) open(seekEnd bool) error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	t.offset = 0
+	if seekEnd {
+		if t.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	t.file = file
+	t.reader = bufio.NewReader(file)
+	t.partial = ""
+	return nil
+}
+
+// readLines sends every complete line, it returns false when ctx is done.
+func (t *tailer) readLines(ctx context.Context, lines chan<- string) bool {
+	for {
+		line, err := t.reader.ReadString('\n')
+		t.offset += int64(len(line))
+		if err != nil {
+			t.partial += line
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, "Read file error ", err)
+			}
+			return true
+		}
+		select {
+		case lines <- strings.TrimSuffix(t.partial+line, "\n"):
+			t.partial = ""
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (t *tailer) checkRotation() {
+	current, err := t.file.Stat()
+	if err != nil {
+		return
+	}
+	latest, err := os.Stat(t.path)
+	if err != nil || !os.SameFile(current, latest) {
+		// Moved or removed, the rest of the old file was read already
+		t.close()
+		return
+	}
+	if latest.Size() < t.offset {
+		// Truncated, e.g. by logrotate copytruncate
+		if _, err := t.file.Seek(0, io.SeekStart); err == nil {
+			t.offset = 0
+			t.reader.Reset(t.file)
+			t.partial = ""
+		}
+	}
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+		t.file = nil
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func appendFile(t *testing.T, path, content string) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectLine(t *testing.T, lines <-chan string, expected string) {
+	select {
+	case line := <-lines:
+		if line != expected {
+			t.Errorf("expected %q, got %q", expected, line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout waiting for %q", expected)
+	}
+}
+
+func TestFollowRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf-forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "old line\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string)
+	go follow(ctx, path, false, 5*time.Millisecond, lines)
+	time.Sleep(20 * time.Millisecond)
+
+	appendFile(t, path, "first ")
+	time.Sleep(20 * time.Millisecond)
+	appendFile(t, path, "line\n")
+	expectLine(t, lines, "first line")
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "after rotation\n")
+	expectLine(t, lines, "after rotation")
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	appendFile(t, path, "after truncate\n")
+	expectLine(t, lines, "after truncate")
+}
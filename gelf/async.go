@@ -0,0 +1,132 @@
+package gelf
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what an async handler does when its queue is full.
+type OverflowPolicy uint8
+
+const (
+	Block OverflowPolicy = iota
+	DropOldest
+	DropNewest
+)
+
+const flushPollInterval = 5 * time.Millisecond
+
+// asyncHandler runs the wrapped handler on its own goroutine behind a bounded queue.
+type asyncHandler struct {
+	handler LogHandler
+	policy  OverflowPolicy
+	queue   chan *Record
+	dropped uint64
+	pending int64
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+func newAsyncHandler(handler LogHandler, size int, policy OverflowPolicy) *asyncHandler {
+	if size < 1 {
+		size = 1
+	}
+	a := &asyncHandler{
+		handler: handler,
+		policy:  policy,
+		queue:   make(chan *Record, size),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *asyncHandler) name() string {
+	return a.handler.name()
+}
+
+func (a *asyncHandler) enabled(r *Record) bool {
+	return a.handler.enabled(r)
+}
+
+func (a *asyncHandler) write(r *Record) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		atomic.AddUint64(&a.dropped, 1)
+		return
+	}
+	atomic.AddInt64(&a.pending, 1)
+	switch a.policy {
+	case DropNewest:
+		select {
+		case a.queue <- r:
+		default:
+			a.drop()
+		}
+	case DropOldest:
+		for {
+			select {
+			case a.queue <- r:
+				return
+			default:
+			}
+			select {
+			case <-a.queue:
+				a.drop()
+			default:
+			}
+		}
+	default:
+		a.queue <- r
+	}
+}
+
+func (a *asyncHandler) drop() {
+	atomic.AddUint64(&a.dropped, 1)
+	atomic.AddInt64(&a.pending, -1)
+}
+
+func (a *asyncHandler) run() {
+	defer close(a.done)
+	for r := range a.queue {
+		a.handler.write(r)
+		atomic.AddInt64(&a.pending, -1)
+	}
+}
+
+// Flush waits until every queued record is written, then flushes the wrapped handler.
+func (a *asyncHandler) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&a.pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	if f, ok := a.handler.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close stops accepting records and waits until the queue is drained.
+func (a *asyncHandler) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+func (a *asyncHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
@@ -0,0 +1,103 @@
+package gelf
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// gateHandler blocks every write until release is closed.
+type gateHandler struct {
+	memoryHandler
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newGateHandler() *gateHandler {
+	return &gateHandler{entered: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (g *gateHandler) write(r *Record) {
+	g.entered <- struct{}{}
+	<-g.release
+	g.memoryHandler.write(r)
+}
+
+func newAsyncLog(t *testing.T, size int, policy OverflowPolicy) (*Log, *gateHandler) {
+	gate := newGateHandler()
+	log := New("")
+	log.AddHandlers(gate)
+	log.SetAsync(size, policy)
+	log.Info("0")
+	select {
+	case <-gate.entered:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not pick up the first record")
+	}
+	return log, gate
+}
+
+func TestAsyncOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		policy   OverflowPolicy
+		expected string
+	}{
+		{DropNewest, "[INFO:0 INFO:1 INFO:2]"},
+		{DropOldest, "[INFO:0 INFO:3 INFO:4]"},
+	}
+	for _, tt := range tests {
+		log, gate := newAsyncLog(t, 2, tt.policy)
+		for i := 1; i <= 4; i++ {
+			log.Info(fmt.Sprint(i))
+		}
+		if dropped := log.Dropped()["memory"]; dropped != 2 {
+			t.Errorf("policy %d: expected 2 dropped records, got %d", tt.policy, dropped)
+		}
+		close(gate.release)
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(gate.messages()); got != tt.expected {
+			t.Errorf("policy %d: expected %v, got %v", tt.policy, tt.expected, got)
+		}
+	}
+}
+
+func TestAsyncBlockAndFlush(t *testing.T) {
+	log, gate := newAsyncLog(t, 1, Block)
+	log.Info("1")
+	written := make(chan struct{})
+	go func() {
+		log.Info("2")
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("Info must block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := log.Flush(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	close(gate.release)
+	<-written
+	if err := log.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(gate.messages()); got != "[INFO:0 INFO:1 INFO:2]" {
+		t.Errorf("unexpected records %v", got)
+	}
+	if gate.flushed != 1 || log.Dropped()["memory"] != 0 {
+		t.Errorf("expected one flush and no drops, got %d flushes", gate.flushed)
+	}
+	_ = log.Close()
+	log.Info("after close")
+	if log.Dropped()["memory"] != 1 {
+		t.Error("records after Close must be dropped")
+	}
+}
@@ -0,0 +1,461 @@
+package gelf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config describes a Log, it is read with LoadConfig or ConfigFromEnv and built with Build.
+//
+//	level: info
+//	name: api
+//	formatter: json
+//	fields:
+//	  service: api
+//	handlers:
+//	  - type: console
+//	  - type: gelf
+//	    server: 128.0.255.10
+//	    port: 12201
+//	    transport: tcp
+//	    level: warn
+type Config struct {
+	Name      string                 `yaml:"name" json:"name"`
+	Level     string                 `yaml:"level" json:"level"`
+	Formatter string                 `yaml:"formatter" json:"formatter"`
+	Fields    map[string]interface{} `yaml:"fields" json:"fields"`
+	Handlers  []HandlerConfig        `yaml:"handlers" json:"handlers"`
+}
+
+// HandlerConfig describes one handler, Type is console, gelf, gelf-http, file or syslog.
+type HandlerConfig struct {
+	Type  string `yaml:"type" json:"type"`
+	Level string `yaml:"level" json:"level"`
+	// Formatter of console and file handlers, the Config formatter by default
+	Formatter string `yaml:"formatter" json:"formatter"`
+
+	// gelf
+	Server      string `yaml:"server" json:"server"`
+	Port        int    `yaml:"port" json:"port"`
+	Transport   string `yaml:"transport" json:"transport"`
+	Compression string `yaml:"compression" json:"compression"`
+	// gelf-http
+	URL string `yaml:"url" json:"url"`
+	// file
+	Path       string `yaml:"path" json:"path"`
+	MaxSize    int64  `yaml:"max_size" json:"max_size"`
+	MaxBackups int    `yaml:"max_backups" json:"max_backups"`
+	Daily      bool   `yaml:"daily" json:"daily"`
+	// syslog
+	Network string `yaml:"network" json:"network"`
+	Address string `yaml:"address" json:"address"`
+	AppName string `yaml:"app_name" json:"app_name"`
+}
+
+// LoadConfig reads a Config from a YAML file, or from JSON when path ends with .json.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, c)
+	} else {
+		err = yaml.Unmarshal(data, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %v: %w", path, err)
+	}
+	// YAML decodes nested maps with interface{} keys, which JSON encoding rejects
+	for key, value := range c.Fields {
+		c.Fields[key] = normalizeYAML(value)
+	}
+	return c, nil
+}
+
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+	}
+	return value
+}
+
+// ConfigFromEnv returns a Config with console output, overridden by the environment, see ApplyEnv.
+// GELF_SERVER adds a gelf handler next to the console.
+func ConfigFromEnv() (*Config, error) {
+	c := &Config{}
+	if err := c.ApplyEnv(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ApplyEnv overrides c with the environment:
+//
+//	LOG_NAME, LOG_LEVEL, LOG_FORMATTER   name, level and formatter
+//	LOG_FIELDS                           static fields, "service=api,env=prod"
+//	GELF_SERVER, GELF_PORT               the gelf handler, added when missing, next to a
+//	                                     console handler when c has no handlers
+//	GELF_TRANSPORT, GELF_COMPRESSION     udp, tcp or tls and none, gzip or zlib
+func (c *Config) ApplyEnv() error {
+	if name, ok := os.LookupEnv("LOG_NAME"); ok {
+		c.Name = name
+	}
+	if level, ok := os.LookupEnv("LOG_LEVEL"); ok {
+		c.Level = level
+	}
+	if formatter, ok := os.LookupEnv("LOG_FORMATTER"); ok {
+		c.Formatter = formatter
+	}
+	if fields := os.Getenv("LOG_FIELDS"); fields != "" {
+		if c.Fields == nil {
+			c.Fields = make(map[string]interface{})
+		}
+		for _, pair := range strings.Split(fields, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("LOG_FIELDS: expected key=value, got %q", pair)
+			}
+			c.Fields[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	server := os.Getenv("GELF_SERVER")
+	if server == "" {
+		return nil
+	}
+	var gelf *HandlerConfig
+	for i := range c.Handlers {
+		if c.Handlers[i].Type == "gelf" {
+			gelf = &c.Handlers[i]
+		}
+	}
+	if gelf == nil {
+		// Build logs to the console only when there are no handlers, keep it
+		if len(c.Handlers) == 0 {
+			c.Handlers = append(c.Handlers, HandlerConfig{Type: "console"})
+		}
+		c.Handlers = append(c.Handlers, HandlerConfig{Type: "gelf", Port: 12201})
+		gelf = &c.Handlers[len(c.Handlers)-1]
+	}
+	gelf.Server = server
+	if port := os.Getenv("GELF_PORT"); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("GELF_PORT: %w", err)
+		}
+		gelf.Port = p
+	}
+	if transport, ok := os.LookupEnv("GELF_TRANSPORT"); ok {
+		gelf.Transport = transport
+	}
+	if compression, ok := os.LookupEnv("GELF_COMPRESSION"); ok {
+		gelf.Compression = compression
+	}
+	return nil
+}
+
+// Build creates a Log with the handlers of c, a Config without handlers logs to the console.
+func (c *Config) Build() (*Log, error) {
+	log := New(c.Name)
+	if c.Level != "" {
+		level, err := ParseLevel(c.Level)
+		if err != nil {
+			return nil, err
+		}
+		log.SetLevel(level)
+	}
+	handlers := c.Handlers
+	if len(handlers) == 0 {
+		handlers = []HandlerConfig{{Type: "console"}}
+	}
+	built := make([]LogHandler, 0, len(handlers))
+	names := make(map[string]bool, len(handlers))
+	for _, hc := range handlers {
+		handler, err := hc.build(c.Formatter)
+		if err != nil {
+			closeHandlers(built)
+			return nil, err
+		}
+		built = append(built, handler)
+		// AddHandlers skips a handler whose name is taken, it would stay open and unused
+		if names[handler.name()] {
+			closeHandlers(built)
+			return nil, fmt.Errorf("duplicate handler %q", handler.name())
+		}
+		names[handler.name()] = true
+	}
+	log.AddHandlers(built...)
+	if len(c.Fields) == 0 {
+		return log, nil
+	}
+	var fields []interface{}
+	for _, key := range sortedKeys(c.Fields) {
+		fields = append(fields, key, c.Fields[key])
+	}
+	return log.With(fields...), nil
+}
+
+func closeHandlers(handlers []LogHandler) {
+	for _, handler := range handlers {
+		if c, ok := handler.(io.Closer); ok {
+			_ = c.Close()
+		}
+	}
+}
+
+// levelSetter is implemented by the handlers that embed baseHandler.
+type levelSetter interface {
+	SetLevel(level LogLevel)
+}
+
+func (hc HandlerConfig) build(formatterName string) (LogHandler, error) {
+	if hc.Formatter != "" {
+		formatterName = hc.Formatter
+	}
+	formatter, err := parseFormatter(formatterName, hc.Type == "console")
+	if err != nil {
+		return nil, err
+	}
+	// Check the level first, so an invalid level does not leave an open handler
+	level := DEBUG
+	if hc.Level != "" {
+		if level, err = ParseLevel(hc.Level); err != nil {
+			return nil, err
+		}
+	}
+	if err := hc.validate(); err != nil {
+		return nil, err
+	}
+	var handler LogHandler
+	switch hc.Type {
+	case "console":
+		console := NewConsoleHandler()
+		console.SetFormatter(formatter)
+		handler = console
+	case "gelf":
+		transport, err := parseTransport(hc.Transport)
+		if err != nil {
+			return nil, err
+		}
+		compression, err := parseCompression(hc.Compression)
+		if err != nil {
+			return nil, err
+		}
+		port := hc.Port
+		if port == 0 {
+			port = 12201
+		}
+		handler = NewGELFHandler(hc.Server, port, WithTransport(transport), WithCompression(compression))
+	case "gelf-http":
+		handler = NewGELFHTTPHandler(hc.URL)
+	case "file":
+		opts := []FileOption{WithFormatter(formatter), WithMaxSize(hc.MaxSize), WithMaxBackups(hc.MaxBackups)}
+		if hc.Daily {
+			opts = append(opts, WithDailyRotation())
+		}
+		handler = NewFileHandler(hc.Path, opts...)
+	case "syslog":
+		var opts []SyslogOption
+		if hc.AppName != "" {
+			opts = append(opts, WithAppName(hc.AppName))
+		}
+		handler = NewSyslogHandler(hc.Network, hc.Address, opts...)
+	default:
+		return nil, fmt.Errorf("unknown handler type %q", hc.Type)
+	}
+	handler.(levelSetter).SetLevel(level)
+	return handler, nil
+}
+
+// validate reports the settings a handler cannot work without, before the handler is created.
+func (hc HandlerConfig) validate() error {
+	var missing []string
+	switch hc.Type {
+	case "gelf":
+		if hc.Server == "" {
+			missing = append(missing, "server")
+		}
+	case "gelf-http":
+		if hc.URL == "" {
+			missing = append(missing, "url")
+		}
+	case "file":
+		if hc.Path == "" {
+			missing = append(missing, "path")
+		}
+	case "syslog":
+		if hc.Network == "" {
+			missing = append(missing, "network")
+		}
+		if hc.Address == "" {
+			missing = append(missing, "address")
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%v handler: missing %v", hc.Type, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// parseFormatter returns the formatter called name. The default and color use colors only
+// on a console whose stdout is a terminal, files never get ANSI codes.
+func parseFormatter(name string, console bool) (Formatter, error) {
+	switch strings.ToLower(name) {
+	case "", "color":
+		return &TextFormatter{Color: console && IsTerminal(os.Stdout)}, nil
+	case "text":
+		return &TextFormatter{}, nil
+	case "json":
+		return &JSONFormatter{}, nil
+	case "logfmt":
+		return &LogfmtFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown formatter %q", name)
+}
+
+func parseTransport(name string) (Transport, error) {
+	switch strings.ToLower(name) {
+	case "", "udp":
+		return TransportUDP, nil
+	case "tcp":
+		return TransportTCP, nil
+	case "tls":
+		return TransportTLS, nil
+	}
+	return TransportUDP, fmt.Errorf("unknown transport %q", name)
+}
+
+func parseCompression(name string) (Compression, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return CompressNone, nil
+	case "gzip":
+		return CompressGzip, nil
+	case "zlib":
+		return CompressZlib, nil
+	}
+	return CompressNone, fmt.Errorf("unknown compression %q", name)
+}
+
+// ReloadLevel reads path again and applies its level and the levels of its handlers,
+// handlers are matched by type and, for files, by path.
+func (l *Log) ReloadLevel(path string) error {
+	c, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	if c.Level != "" {
+		level, err := ParseLevel(c.Level)
+		if err != nil {
+			return err
+		}
+		l.SetLevel(level)
+	}
+	for _, hc := range c.Handlers {
+		if hc.Level == "" {
+			continue
+		}
+		level, err := ParseLevel(hc.Level)
+		if err != nil {
+			return err
+		}
+		name := hc.Type
+		if hc.Type == "file" {
+			name = "file:" + hc.Path
+		}
+		if err := l.SetHandlerLevel(name, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetHandlerLevel sets the level of the handler called name, e.g. "gelf", "console" or "file:app.log".
+func (l *Log) SetHandlerLevel(name string, level LogLevel) error {
+	l.core.mu.Lock()
+	handler := l.core.handler(name)
+	l.core.mu.Unlock()
+	for ; handler != nil; handler = unwrap(handler) {
+		if setter, ok := handler.(levelSetter); ok {
+			setter.SetLevel(level)
+			return nil
+		}
+	}
+	return fmt.Errorf("no handler %q with a level", name)
+}
+
+// ReloadOnSIGHUP calls ReloadLevel with path on every SIGHUP until stop is called.
+func (l *Log) ReloadOnSIGHUP(path string) (stop func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-hup:
+				if err := l.ReloadLevel(path); err != nil {
+					fmt.Println("Reload log config error ", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hup)
+		close(done)
+	}
+}
+
+// WatchConfig checks the modification time of path every interval and calls ReloadLevel
+// when it changes, until stop is called.
+func (l *Log) WatchConfig(path string, interval time.Duration) (stop func()) {
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil || info.ModTime().Equal(modTime) {
+					continue
+				}
+				modTime = info.ModTime()
+				if err := l.ReloadLevel(path); err != nil {
+					fmt.Println("Reload log config error ", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,207 @@
+package gelf
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"goutils/gelf/gelftest"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server, err := gelftest.NewTCPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	yamlPath := writeConfig(t, dir, "log.yaml", `
+name: api
+level: info
+formatter: json
+fields:
+  service: api
+  build:
+    commit: abc
+handlers:
+  - type: gelf
+    server: `+server.Host()+`
+    port: `+strconv.Itoa(server.Port())+`
+    transport: tcp
+    level: warn
+  - type: file
+    path: `+filepath.Join(dir, "app.log")+`
+`)
+	c, err := LoadConfig(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	log.Debug("skipped")
+	log.Info("file only")
+	log.Warnw("both", "user", "tom")
+
+	messages, err := server.WaitMessages(1, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := messages[0]
+	if m.ShortMessage != "both" || m.Extra["_service"] != "api" || m.Extra["_logger"] != "api" || m.Extra["_user"] != "tom" {
+		t.Errorf("unexpected message %+v", m)
+	}
+	if m.Extra["_build"] != "map[commit:abc]" {
+		t.Errorf("unexpected nested field %v", m.Extra["_build"])
+	}
+	if err := log.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if content := readFile(t, filepath.Join(dir, "app.log")); content[0] != '{' || len(server.Messages()) != 1 {
+		t.Errorf("unexpected file %q", content)
+	}
+
+	jsonPath := writeConfig(t, dir, "log.json", `{"level": "verbose"}`)
+	if c, err = LoadConfig(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Build(); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{"LOG_LEVEL": "error", "LOG_FIELDS": "service=api, env=prod", "GELF_SERVER": "10.0.0.1", "GELF_TRANSPORT": "tcp"}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Level != "error" || c.Fields["env"] != "prod" || len(c.Handlers) != 2 || c.Handlers[0].Type != "console" {
+		t.Fatalf("unexpected config %+v", c)
+	}
+	if gelf := c.Handlers[1]; gelf.Type != "gelf" || gelf.Server != "10.0.0.1" || gelf.Port != 12201 || gelf.Transport != "tcp" {
+		t.Errorf("unexpected gelf handler %+v", gelf)
+	}
+}
+
+func TestReloadLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfig(t, dir, "log.yaml", "level: error\n")
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := &memoryHandler{}
+	log.AddHandlers(memory)
+
+	stopWatch := log.WatchConfig(path, 5*time.Millisecond)
+	defer stopWatch()
+	writeConfig(t, dir, "log.yaml", "level: debug\nhandlers:\n  - type: console\n    level: warn\n")
+	// The file may change within the resolution of its modification time
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return log.Level() == DEBUG })
+	if console := log.core.handler("console").(*ConsoleHandler); console.Level() != WARN {
+		t.Errorf("expected console level WARN, got %v", console.Level())
+	}
+
+	stopHUP := log.ReloadOnSIGHUP(path)
+	defer stopHUP()
+	writeConfig(t, dir, "log.yaml", "level: fatal\n")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return log.Level() == FATAL })
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConfigBuildErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	tests := []*Config{
+		{Handlers: []HandlerConfig{{Type: "gelf", Server: "10.0.0.1"}, {Type: "gelf", Server: "10.0.0.2"}}},
+		{Handlers: []HandlerConfig{{Type: "file", Path: path}, {Type: "console", Level: "verbose"}}},
+		{Handlers: []HandlerConfig{{Type: "file", Path: path}, {Type: "unknown"}}},
+		{Handlers: []HandlerConfig{{Type: "gelf"}}},
+		{Handlers: []HandlerConfig{{Type: "gelf-http"}}},
+		{Handlers: []HandlerConfig{{Type: "file"}}},
+		{Handlers: []HandlerConfig{{Type: "syslog", Network: "udp"}}},
+	}
+	for i, c := range tests {
+		if _, err := c.Build(); err == nil {
+			t.Errorf("%d: expected an error", i)
+		}
+	}
+	c := &Config{Handlers: []HandlerConfig{{Type: "file", Path: path}, {Type: "gelf", Server: "10.0.0.1"}, {Type: "file", Path: path + ".2"}}}
+	log, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if levels := log.HandlerLevels(); len(levels) != 3 {
+		t.Errorf("expected 3 handlers, got %v", levels)
+	}
+}
+
+func TestConfigFormatterColor(t *testing.T) {
+	for _, console := range []bool{true, false} {
+		formatter, err := parseFormatter("color", console)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Test output is not a terminal, files never get colors
+		if formatter.(*TextFormatter).Color {
+			t.Errorf("console %v: unexpected colors", console)
+		}
+	}
+	if NewConsoleHandler().formatter.(*TextFormatter).Color != IsTerminal(os.Stdout) {
+		t.Error("console colors must follow the terminal")
+	}
+}
@@ -0,0 +1,120 @@
+package gelf
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ContextExtractor returns key/value pairs carried by ctx, e.g. "request_id", id.
+// It must be cheap and return nil when ctx holds nothing it knows.
+type ContextExtractor func(ctx context.Context) []interface{}
+
+var (
+	extractorsMu sync.Mutex
+	extractors   atomic.Value // []ContextExtractor, replaced on every registration
+)
+
+func init() {
+	extractors.Store([]ContextExtractor{requestIDExtractor, traceExtractor})
+}
+
+// RegisterContextExtractor adds e to the extractors run by the *Ctx methods, after the
+// built-in request_id and trace_id/span_id ones. Register extractors during init.
+func RegisterContextExtractor(e ContextExtractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	current := extractors.Load().([]ContextExtractor)
+	next := make([]ContextExtractor, len(current), len(current)+1)
+	copy(next, current)
+	extractors.Store(append(next, e))
+}
+
+// contextFields prepends the pairs extracted from ctx, so explicit pairs win over them.
+func contextFields(ctx context.Context, keysAndValues []interface{}) []interface{} {
+	if ctx == nil {
+		return keysAndValues
+	}
+	var fields []interface{}
+	for _, extract := range extractors.Load().([]ContextExtractor) {
+		fields = append(fields, extract(ctx)...)
+	}
+	if len(fields) == 0 {
+		return keysAndValues
+	}
+	return append(fields, keysAndValues...)
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	traceKey
+)
+
+type trace struct {
+	traceID string
+	spanID  string
+}
+
+// ContextWithRequestID returns a copy of ctx that logs id as request_id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the id stored by ContextWithRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok
+}
+
+// ContextWithTrace returns a copy of ctx that logs trace_id and span_id, spanID may be empty.
+func ContextWithTrace(ctx context.Context, traceID, spanID string) context.Context {
+	return context.WithValue(ctx, traceKey, trace{traceID, spanID})
+}
+
+// TraceFromContext returns the ids stored by ContextWithTrace.
+func TraceFromContext(ctx context.Context) (traceID, spanID string, ok bool) {
+	t, ok := ctx.Value(traceKey).(trace)
+	return t.traceID, t.spanID, ok
+}
+
+func requestIDExtractor(ctx context.Context) []interface{} {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return []interface{}{"request_id", id}
+	}
+	return nil
+}
+
+func traceExtractor(ctx context.Context) []interface{} {
+	traceID, spanID, ok := TraceFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if spanID == "" {
+		return []interface{}{"trace_id", traceID}
+	}
+	return []interface{}{"trace_id", traceID, "span_id", spanID}
+}
+
+// DebugCtx logs msg with the pairs extracted from ctx and keysAndValues.
+func (l *Log) DebugCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.log(DEBUG, msg, contextFields(ctx, keysAndValues))
+}
+
+func (l *Log) InfoCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.log(INFO, msg, contextFields(ctx, keysAndValues))
+}
+
+func (l *Log) WarnCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.log(WARN, msg, contextFields(ctx, keysAndValues))
+}
+
+func (l *Log) ErrorCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.log(ERROR, msg, contextFields(ctx, keysAndValues))
+}
+
+// LogCtx logs msg at level like Logw, with the pairs extracted from ctx.
+func (l *Log) LogCtx(ctx context.Context, level LogLevel, msg string, keysAndValues ...interface{}) {
+	l.log(level, msg, contextFields(ctx, keysAndValues))
+}
@@ -0,0 +1,52 @@
+package gelf
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tenantKey struct{}
+
+func TestLogCtx(t *testing.T) {
+	log, server := newGELFTestLog(t, "")
+	defer server.Close()
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	ctx = ContextWithTrace(ctx, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	log.InfoCtx(ctx, "handled", "status", 200)
+	log.WarnCtx(context.Background(), "no ids")
+
+	messages, err := server.WaitMessages(2, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := messages[0].Extra
+	if extra["_request_id"] != "req-1" || extra["_trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || extra["_span_id"] != "00f067aa0ba902b7" || extra["_status"] != int64(200) {
+		t.Errorf("unexpected fields %v", extra)
+	}
+	if _, ok := messages[1].Extra["_request_id"]; ok {
+		t.Errorf("unexpected fields %v", messages[1].Extra)
+	}
+}
+
+func TestRegisterContextExtractor(t *testing.T) {
+	RegisterContextExtractor(func(ctx context.Context) []interface{} {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			return []interface{}{"tenant", tenant}
+		}
+		return nil
+	})
+	log, memory := newMemoryLog()
+	ctx := context.WithValue(ContextWithRequestID(context.Background(), "req-2"), tenantKey{}, "acme")
+	log.ErrorCtx(ctx, "failed", "request_id", "explicit")
+
+	r := memory.records[0]
+	if r.Fields["tenant"] != "acme" || r.Fields["request_id"] != "explicit" {
+		t.Errorf("unexpected fields %v", r.Fields)
+	}
+	line := string((&TextFormatter{}).Format(r))
+	if !strings.Contains(line, " request_id=explicit tenant=acme") {
+		t.Errorf("unexpected console line %q", line)
+	}
+}
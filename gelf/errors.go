@@ -0,0 +1,155 @@
+package gelf
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxStackFrames bounds the trace captured for an error.
+const maxStackFrames = 64
+
+// errField marks an error in a key/value list, see Err.
+type errField struct {
+	err error
+}
+
+// Err attaches err to the record as a single element of a key/value list, e.g.
+// log.Errorw("save failed", gelf.Err(err), "user", id). GELF puts the error chain in
+// _error and the stack trace in full_message.
+func Err(err error) interface{} {
+	return errField{err}
+}
+
+// extractErr removes the Err elements from keysAndValues and returns the last error.
+func extractErr(keysAndValues []interface{}) (error, []interface{}) {
+	var err error
+	found := false
+	for _, kv := range keysAndValues {
+		if field, ok := kv.(errField); ok {
+			err = field.err
+			found = true
+		}
+	}
+	if !found {
+		return nil, keysAndValues
+	}
+	rest := make([]interface{}, 0, len(keysAndValues)-1)
+	for _, kv := range keysAndValues {
+		if _, ok := kv.(errField); !ok {
+			rest = append(rest, kv)
+		}
+	}
+	return err, rest
+}
+
+// ErrorWithErr logs msg at ERROR with err and the stack trace of the caller.
+func (l *Log) ErrorWithErr(msg string, err error) {
+	l.log(ERROR, msg, []interface{}{Err(err)})
+}
+
+// SetErrorStacks makes records at ERROR and above carry the stacks of all goroutines,
+// not only the caller's trace of records with an error.
+func (l *Log) SetErrorStacks(enabled bool) {
+	var value uint32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreUint32(&l.core.stacks, value)
+}
+
+// stack returns the trace attached to an ERROR record, or "" when there is nothing to attach.
+func (l *Log) stack(err error, skip int) string {
+	if atomic.LoadUint32(&l.core.stacks) == 1 {
+		return allStacks()
+	}
+	if err == nil {
+		return ""
+	}
+	return callerStack(skip + 1)
+}
+
+// callerStack formats the frames above skip like a goroutine trace in a panic.
+func callerStack(skip int) string {
+	pcs := make([]uintptr, maxStackFrames)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%v\n\t%v:%v\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func allStacks() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// errorChain returns the messages of err and every error it wraps, joined by " <- ".
+func errorChain(err error) string {
+	var chain []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		chain = append(chain, err.Error())
+	}
+	return strings.Join(chain, " <- ")
+}
+
+// RecoverAndLog logs a panic at PANIC with its value and stack, flushes the handlers
+// and panics again. Defer it at the top of a goroutine:
+//
+//	go func() {
+//		defer log.RecoverAndLog()
+//		...
+//	}()
+func (l *Log) RecoverAndLog() {
+	value := recover()
+	if value == nil {
+		return
+	}
+	if PANIC >= l.Level() {
+		err, ok := value.(error)
+		if !ok {
+			err = fmt.Errorf("%v", value)
+		}
+		r := &Record{Level: PANIC, Time: time.Now(), Message: fmt.Sprint("panic: ", value), Logger: l.name, Fields: mergeFields(l.fields, nil), Err: err}
+		r.Caller = panicCaller()
+		// The trace starts at runtime.gopanic, like the one printed by the runtime
+		r.Stack = l.stack(err, 3)
+		l.dispatch(r)
+		l.flushBeforeExit()
+	}
+	panic(value)
+}
+
+// panicCaller returns the frame that called panic, seen from a deferred function.
+func panicCaller() Caller {
+	pcs := make([]uintptr, maxStackFrames)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return Caller{File: frame.File, Line: frame.Line, Function: frame.Function}
+		}
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		}
+		if !more {
+			return Caller{}
+		}
+	}
+}
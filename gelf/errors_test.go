@@ -0,0 +1,79 @@
+package gelf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorWithErr(t *testing.T) {
+	log, server := newGELFTestLog(t, "")
+	defer server.Close()
+	base := errors.New("connection refused")
+	log.ErrorWithErr("save failed", fmt.Errorf("dial db: %w", base))
+	log.Errorw("retry failed", Err(base), "attempt", 2)
+	log.Error("no error")
+
+	messages, err := server.WaitMessages(3, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain := messages[0].Extra["_error"]; chain != "dial db: connection refused <- connection refused" {
+		t.Errorf("unexpected error chain %v", chain)
+	}
+	full := messages[0].FullMessage
+	if !strings.HasPrefix(full, "save failed: dial db: connection refused\n\n") || !strings.Contains(full, "gelf.TestErrorWithErr\n") {
+		t.Errorf("unexpected full_message %q", full)
+	}
+	if strings.Contains(full, "gelf.(*Log).ErrorWithErr") {
+		t.Errorf("stack trace starts inside the logger %q", full)
+	}
+	if messages[1].Extra["_error"] != "connection refused" || messages[1].Extra["_attempt"] != int64(2) || messages[1].FullMessage == "" {
+		t.Errorf("unexpected message %+v", messages[1])
+	}
+	if _, ok := messages[2].Extra["_error"]; ok || messages[2].FullMessage != "" {
+		t.Errorf("unexpected error fields %+v", messages[2])
+	}
+}
+
+func TestErrorStacks(t *testing.T) {
+	log, memory := newMemoryLog()
+	log.Warnw("warn", Err(errors.New("e")))
+	log.SetErrorStacks(true)
+	log.Error("error")
+	if memory.records[0].Err == nil || memory.records[0].Stack != "" {
+		t.Errorf("expected an error without stack below ERROR, got %+v", memory.records[0])
+	}
+	if stack := memory.records[1].Stack; !strings.HasPrefix(stack, "goroutine ") {
+		t.Errorf("expected all goroutine stacks, got %q", stack)
+	}
+}
+
+func TestRecoverAndLog(t *testing.T) {
+	log, memory := newMemoryLog()
+	done := make(chan interface{})
+	go func() {
+		defer func() { done <- recover() }()
+		defer log.RecoverAndLog()
+		var m map[string]int
+		m["crash"] = 1
+	}()
+	if recovered := <-done; recovered == nil {
+		t.Fatal("RecoverAndLog must panic again")
+	}
+	if len(memory.records) != 1 {
+		t.Fatalf("expected one record, got %v", memory.messages())
+	}
+	r := memory.records[0]
+	if r.Level != PANIC || !strings.Contains(r.Message, "assignment to entry in nil map") || r.Err == nil {
+		t.Errorf("unexpected record %+v", r)
+	}
+	if !strings.Contains(r.Caller.Function, "TestRecoverAndLog.func") || !strings.Contains(r.Stack, "runtime.gopanic") {
+		t.Errorf("unexpected caller %+v or stack %q", r.Caller, r.Stack)
+	}
+	if memory.flushed != 1 {
+		t.Errorf("expected one flush, got %d", memory.flushed)
+	}
+}
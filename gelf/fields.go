@@ -0,0 +1,55 @@
+package gelf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// badKey holds a value that has no key, e.g. the last element of an odd key/value list.
+const badKey = "!BADKEY"
+
+// mergeFields returns a new map with base and the key/value pairs, or nil when both are empty.
+func mergeFields(base map[string]interface{}, keysAndValues []interface{}) map[string]interface{} {
+	if len(base) == 0 && len(keysAndValues) == 0 {
+		return nil
+	}
+	fields := make(map[string]interface{}, len(base)+len(keysAndValues)/2)
+	for key, value := range base {
+		fields[key] = value
+	}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			fields[badKey] = keysAndValues[i]
+			break
+		}
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		fields[key] = keysAndValues[i+1]
+	}
+	return fields
+}
+
+// formatFields renders fields as " key=value" pairs sorted by key.
+func formatFields(fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, key := range sortedKeys(fields) {
+		b.WriteString(" ")
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(quoteValue(fmt.Sprint(fields[key])))
+	}
+	return b.String()
+}
+
+func quoteValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,311 @@
+package gelf
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	dayFormat        = "2006-01-02"
+)
+
+// FileHandler writes records to a local file, which keeps a record when Graylog is down.
+type FileHandler struct {
+	baseHandler
+	path        string
+	maxSize     int64
+	daily       bool
+	maxBackups  int
+	compress    bool
+	reopenOnHUP bool
+	formatter   Formatter
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	day  string
+	hup  chan os.Signal
+}
+
+type FileOption func(f *FileHandler)
+
+func WithFormatter(formatter Formatter) FileOption {
+	return func(f *FileHandler) {
+		f.formatter = formatter
+	}
+}
+
+// WithMaxSize rotates the file before it grows over size bytes.
+func WithMaxSize(size int64) FileOption {
+	return func(f *FileHandler) {
+		f.maxSize = size
+	}
+}
+
+// WithDailyRotation rotates the file when the day of a record differs from the day the file was opened.
+func WithDailyRotation() FileOption {
+	return func(f *FileHandler) {
+		f.daily = true
+	}
+}
+
+// WithMaxBackups keeps the newest n rotated files, 0 keeps all of them.
+func WithMaxBackups(n int) FileOption {
+	return func(f *FileHandler) {
+		f.maxBackups = n
+	}
+}
+
+// WithGzipBackups compresses rotated files.
+func WithGzipBackups() FileOption {
+	return func(f *FileHandler) {
+		f.compress = true
+	}
+}
+
+// WithReopenOnSIGHUP reopens the file on SIGHUP, so logrotate can move it away.
+func WithReopenOnSIGHUP() FileOption {
+	return func(f *FileHandler) {
+		f.reopenOnHUP = true
+	}
+}
+
+func NewFileHandler(path string, opts ...FileOption) *FileHandler {
+	f := &FileHandler{path: path, formatter: &TextFormatter{}}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.reopenOnHUP {
+		f.hup = make(chan os.Signal, 1)
+		signal.Notify(f.hup, syscall.SIGHUP)
+		go f.watchHUP(f.hup)
+	}
+	return f
+}
+
+func (f *FileHandler) name() string {
+	return "file:" + f.path
+}
+
+func (f *FileHandler) write(r *Record) {
+	line := f.formatter.Format(r)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.rotateIfNeeded(r.Time, int64(len(line))); err != nil {
+		fmt.Println("Rotate log file error ", err)
+	}
+	if f.file == nil {
+		if err := f.open(r.Time); err != nil {
+			fmt.Println("Open log file error ", err)
+			return
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		fmt.Println("Write log file error ", err)
+	}
+}
+
+func (f *FileHandler) open(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.day = now.Format(dayFormat)
+	if f.daily && f.size > 0 {
+		// Keep the day of an existing file, so a restart after midnight still rotates it
+		f.day = info.ModTime().Format(dayFormat)
+	}
+	return nil
+}
+
+// rotateIfNeeded must be called with f.mu held.
+func (f *FileHandler) rotateIfNeeded(now time.Time, next int64) error {
+	if f.file == nil {
+		if err := f.open(now); err != nil {
+			return err
+		}
+	}
+	sizeExceeded := f.maxSize > 0 && f.size > 0 && f.size+next > f.maxSize
+	dayChanged := f.daily && f.day != now.Format(dayFormat)
+	if !sizeExceeded && !dayChanged {
+		return nil
+	}
+	return f.rotate(now)
+}
+
+// rotate must be called with f.mu held.
+func (f *FileHandler) rotate(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backup := f.backupName(now)
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if f.compress {
+		if err := gzipFile(backup); err != nil {
+			return err
+		}
+	}
+	if err := f.removeOldBackups(); err != nil {
+		return err
+	}
+	return f.open(now)
+}
+
+// backupName returns an unused name that sorts after the existing backups.
+func (f *FileHandler) backupName(now time.Time) string {
+	for {
+		backup := f.path + "." + now.Format(backupTimeFormat)
+		if !fileExists(backup) && !fileExists(backup+".gz") {
+			return backup
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+// backups lists the files named path.<backupTimeFormat>, with an optional .gz. The directory
+// is read instead of globbing, so other files with the same prefix and glob characters in
+// path cannot match.
+func (f *FileHandler) backups() ([]string, error) {
+	dir, base := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	return backups, nil
+}
+
+func (f *FileHandler) removeOldBackups() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	// Backup names end with a sortable timestamp, the oldest come first
+	sort.Strings(backups)
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func (f *FileHandler) watchHUP(hup chan os.Signal) {
+	for range hup {
+		if err := f.Reopen(); err != nil {
+			fmt.Println("Reopen log file error ", err)
+		}
+	}
+}
+
+// Reopen closes the file and opens path again, e.g. after logrotate moved it.
+func (f *FileHandler) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	return f.open(time.Now())
+}
+
+// Flush commits the file to disk.
+func (f *FileHandler) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+func (f *FileHandler) Close() error {
+	if f.hup != nil {
+		signal.Stop(f.hup)
+		close(f.hup)
+		f.hup = nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(dst)
+	if _, err := io.Copy(w, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,159 @@
+package gelf
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasSuffix(path, ".gz") {
+		r, err := gzip.NewReader(strings.NewReader(string(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return string(data)
+}
+
+func backups(t *testing.T, path string) []string {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func TestFileHandlerSizeRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs", "app.log")
+	file := NewFileHandler(path, WithMaxSize(150), WithMaxBackups(2), WithGzipBackups())
+	defer file.Close()
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		r := testRecord(INFO, strings.Repeat("x", 40))
+		r.Time = now.Add(time.Duration(i) * time.Second)
+		file.write(r)
+		file.write(r)
+	}
+	rotated := backups(t, path)
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 backups, got %v", rotated)
+	}
+	for _, backup := range rotated {
+		if !strings.HasSuffix(backup, ".gz") {
+			t.Errorf("backup %v is not compressed", backup)
+		}
+		if lines := strings.Count(readFile(t, backup), "\n"); lines != 2 {
+			t.Errorf("expected 2 lines in %v, got %d", backup, lines)
+		}
+	}
+	if lines := strings.Count(readFile(t, path), "\n"); lines != 2 {
+		t.Errorf("expected 2 lines in the current file, got %d", lines)
+	}
+}
+
+func TestFileHandlerDailyRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	file := NewFileHandler(path, WithDailyRotation())
+	defer file.Close()
+
+	today := time.Now()
+	r := testRecord(INFO, "today")
+	r.Time = today
+	file.write(r)
+	r = testRecord(INFO, "tomorrow")
+	r.Time = today.Add(24 * time.Hour)
+	file.write(r)
+
+	rotated := backups(t, path)
+	if len(rotated) != 1 || !strings.Contains(readFile(t, rotated[0]), "today") {
+		t.Fatalf("expected one backup with yesterday's record, got %v", rotated)
+	}
+	if content := readFile(t, path); !strings.Contains(content, "tomorrow") || strings.Contains(content, "today") {
+		t.Errorf("unexpected current file %q", content)
+	}
+}
+
+func TestFileHandlerReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	file := NewFileHandler(path)
+	defer file.Close()
+
+	file.write(testRecord(INFO, "before logrotate"))
+	// logrotate moves the file away and signals the process
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	file.write(testRecord(INFO, "after logrotate"))
+	if content := readFile(t, path); !strings.Contains(content, "after logrotate") || strings.Contains(content, "before") {
+		t.Errorf("unexpected current file %q", content)
+	}
+	if !strings.Contains(readFile(t, path+".1"), "before logrotate") {
+		t.Error("moved file lost its records")
+	}
+}
+
+func TestFileHandlerKeepsOtherFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Glob characters in the path must not widen the match
+	path := filepath.Join(dir, "app[1]")
+	others := []string{path + ".log", path + ".lock", path + ".2000-01-01", filepath.Join(dir, "app1.2000-01-01T00-00-00.000")}
+	for _, other := range others {
+		if err := ioutil.WriteFile(other, []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := NewFileHandler(path, WithMaxSize(10), WithMaxBackups(1))
+	defer file.Close()
+	for i := 0; i < 4; i++ {
+		file.write(testRecord(INFO, strings.Repeat("x", 20)))
+	}
+	for _, other := range others {
+		if _, err := os.Stat(other); err != nil {
+			t.Errorf("%v was removed: %v", other, err)
+		}
+	}
+	matches, err := file.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected one backup, got %v", matches)
+	}
+}
@@ -0,0 +1,67 @@
+package gelf
+
+import (
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// Filter reports whether a record should be written by a handler.
+type Filter func(r *Record) bool
+
+// baseHandler holds the minimum level and the filters of a handler, handlers embed it.
+type baseHandler struct {
+	level uint32
+
+	filterMu sync.RWMutex
+	filters  []Filter
+}
+
+// SetLevel sets the minimum level of the handler, records below it are skipped
+// even if the Log level lets them through.
+func (b *baseHandler) SetLevel(level LogLevel) {
+	atomic.StoreUint32(&b.level, uint32(level))
+}
+
+func (b *baseHandler) Level() LogLevel {
+	return LogLevel(atomic.LoadUint32(&b.level))
+}
+
+// AddFilter adds filters that run before write, a record is written only if every filter returns true.
+func (b *baseHandler) AddFilter(filters ...Filter) {
+	b.filterMu.Lock()
+	b.filters = append(b.filters, filters...)
+	b.filterMu.Unlock()
+}
+
+func (b *baseHandler) enabled(r *Record) bool {
+	if r.Level < b.Level() {
+		return false
+	}
+	b.filterMu.RLock()
+	defer b.filterMu.RUnlock()
+	for _, filter := range b.filters {
+		if !filter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// DropMatching drops records whose message matches re.
+func DropMatching(re *regexp.Regexp) Filter {
+	return func(r *Record) bool {
+		return !re.MatchString(r.Message)
+	}
+}
+
+// Sample lets through one of every n records at level, records at other levels are not affected.
+func Sample(level LogLevel, n int) Filter {
+	var count uint64
+	return func(r *Record) bool {
+		if r.Level != level || n <= 1 {
+			return true
+		}
+		return atomic.AddUint64(&count, 1)%uint64(n) == 1
+	}
+}
@@ -0,0 +1,52 @@
+package gelf
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestHandlerLevel(t *testing.T) {
+	log, debug := newMemoryLog()
+	warn := &memoryHandler{}
+	warn.SetLevel(WARN)
+	log.AddHandlers(namedHandler{warn, "warn"})
+	log.SetLevel(DEBUG)
+	log.Debug("d")
+	log.Info("i")
+	log.Warn("w")
+	if got := fmt.Sprint(debug.messages()); got != "[DEBUG:d INFO:i WARN:w]" {
+		t.Errorf("unexpected records in debug handler %v", got)
+	}
+	if got := fmt.Sprint(warn.messages()); got != "[WARN:w]" {
+		t.Errorf("unexpected records in warn handler %v", got)
+	}
+}
+
+func TestHandlerFilters(t *testing.T) {
+	log, memory := newMemoryLog()
+	memory.AddFilter(DropMatching(regexp.MustCompile(`^health`)), Sample(DEBUG, 3))
+	log.Info("healthcheck ok")
+	log.Info("request done")
+	for i := 1; i <= 7; i++ {
+		log.Debug(fmt.Sprint(i))
+	}
+	expected := "[INFO:request done DEBUG:1 DEBUG:4 DEBUG:7]"
+	if got := fmt.Sprint(memory.messages()); got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestAsyncHandlerFilters(t *testing.T) {
+	log, memory := newMemoryLog()
+	memory.SetLevel(ERROR)
+	log.SetAsync(10, Block)
+	log.Info("skipped")
+	log.Error("written")
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(memory.messages()); got != "[ERROR:written]" {
+		t.Errorf("unexpected records %v", got)
+	}
+}
@@ -0,0 +1,143 @@
+package gelf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formatter renders a record as one line, it is shared by ConsoleHandler and FileHandler.
+type Formatter interface {
+	Format(r *Record) []byte
+}
+
+var levelColors = map[LogLevel]string{
+	DEBUG: "\x1b[90m",
+	INFO:  "\x1b[32m",
+	WARN:  "\x1b[33m",
+	ERROR: "\x1b[31m",
+	PANIC: "\x1b[35m",
+	FATAL: "\x1b[35m",
+}
+
+const colorReset = "\x1b[0m"
+
+// TextFormatter renders "time LEVEL [file:line] msg key=value", Color wraps the level in ANSI colors.
+type TextFormatter struct {
+	Color bool
+}
+
+func (f *TextFormatter) Format(r *Record) []byte {
+	level := r.Level.String()
+	if f.Color {
+		level = levelColors[r.Level] + level + colorReset
+	}
+	_vars := strings.Split(r.Caller.File, "/")
+	file := _vars[len(_vars)-1]
+	_msg := fmt.Sprintf("%v %v [%v:%v] %v%v%v\n", r.Time.Format(timeFormat), level, file, r.Caller.Line, r.Message, formatFields(r.Fields), formatErr(r))
+	// The stack follows on its own lines, as in a panic
+	return []byte(_msg + r.Stack)
+}
+
+// JSONFormatter renders one JSON object per line, fields are added next to time, level, caller and msg.
+type JSONFormatter struct {
+}
+
+func (f *JSONFormatter) Format(r *Record) []byte {
+	entry := make(map[string]interface{}, len(r.Fields)+5)
+	for key, value := range r.Fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+	entry["time"] = r.Time.Format(time.RFC3339Nano)
+	entry["level"] = strings.ToLower(r.Level.String())
+	entry["msg"] = r.Message
+	if caller := callerString(r.Caller); caller != "" {
+		entry["caller"] = caller
+	}
+	if r.Logger != "" {
+		entry["logger"] = r.Logger
+	}
+	if r.Err != nil {
+		entry["error"] = errorChain(r.Err)
+	}
+	if r.Stack != "" {
+		entry["stack"] = r.Stack
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"level": "error", "msg": "Parse JSON error " + err.Error()})
+	}
+	return append(data, '\n')
+}
+
+// LogfmtFormatter renders "time=... level=info caller=main.go:12 msg=... key=value".
+type LogfmtFormatter struct {
+}
+
+func (f *LogfmtFormatter) Format(r *Record) []byte {
+	var b strings.Builder
+	b.WriteString("time=")
+	b.WriteString(r.Time.Format(time.RFC3339Nano))
+	b.WriteString(" level=")
+	b.WriteString(strings.ToLower(r.Level.String()))
+	if caller := callerString(r.Caller); caller != "" {
+		b.WriteString(" caller=")
+		b.WriteString(caller)
+	}
+	if r.Logger != "" {
+		b.WriteString(" logger=")
+		b.WriteString(quoteValue(r.Logger))
+	}
+	b.WriteString(" msg=")
+	b.WriteString(quoteValue(r.Message))
+	b.WriteString(formatFields(r.Fields))
+	b.WriteString(formatErr(r))
+	if r.Stack != "" {
+		b.WriteString(" stack=")
+		b.WriteString(strconv.Quote(r.Stack))
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
+
+// formatErr renders the error chain of r as " error=...".
+func formatErr(r *Record) string {
+	if r.Err == nil {
+		return ""
+	}
+	return " error=" + quoteValue(errorChain(r.Err))
+}
+
+func callerString(c Caller) string {
+	if c.File == "" {
+		return ""
+	}
+	_vars := strings.Split(c.File, "/")
+	return fmt.Sprintf("%v:%v", _vars[len(_vars)-1], c.Line)
+}
+
+// IsTerminal reports whether f is a terminal, e.g. to enable TextFormatter colors only for interactive output.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// sortedKeys returns the keys of fields in a stable order.
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,57 @@
+package gelf
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func formatRecord() *Record {
+	return &Record{
+		Level:   INFO,
+		Time:    time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC),
+		Message: "login",
+		Caller:  Caller{File: "/src/app/main.go", Line: 12},
+		Fields:  map[string]interface{}{"user": "tom", "path": "/a b", "status": 200},
+	}
+}
+
+func TestTextFormatter(t *testing.T) {
+	expected := "2023/4/5 06:07:08.000 INFO [main.go:12] login path=\"/a b\" status=200 user=tom\n"
+	if got := string((&TextFormatter{}).Format(formatRecord())); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	expected = "2023/4/5 06:07:08.000 \x1b[32mINFO\x1b[0m [main.go:12] login path=\"/a b\" status=200 user=tom\n"
+	if got := string((&TextFormatter{Color: true}).Format(formatRecord())); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	line := (&JSONFormatter{}).Format(formatRecord())
+	if line[len(line)-1] != '\n' {
+		t.Error("JSON line must end with a newline")
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(line, &entry); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"time": "2023-04-05T06:07:08Z", "level": "info", "caller": "main.go:12", "msg": "login",
+		"user": "tom", "path": "/a b", "status": float64(200),
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("%v: expected %v, got %v", key, value, entry[key])
+		}
+	}
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	r := formatRecord()
+	r.Message = "user login"
+	expected := "time=2023-04-05T06:07:08Z level=info caller=main.go:12 msg=\"user login\" path=\"/a b\" status=200 user=tom\n"
+	if got := string((&LogfmtFormatter{}).Format(r)); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
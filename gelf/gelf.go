@@ -1,81 +1,454 @@
 package gelf
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"net"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	/*
-	// Ethernet default MTU is 1500 Byte, when great then MTU while happen fragmentation.
-	// The 1500 Byte is TCP/UDP max data size
-	// So, Singer UDP Data size max is LAN MTU 1500 Byte - IP Header 20 Byte - UDPHeader 8 Byte = 1472 Byte
+		// Ethernet default MTU is 1500 Byte, when great then MTU while happen fragmentation.
+		// The 1500 Byte is TCP/UDP max data size
+		// So, Singer UDP Data size max is LAN MTU 1500 Byte - IP Header 20 Byte - UDPHeader 8 Byte = 1472 Byte
 	*/
 
 	UDPChunkSize = 1472
+
+	// Chunk header: 2 magic bytes, 8 byte message id, 1 byte sequence number and 1 byte sequence count.
+	chunkHeaderSize = 12
+	chunkDataSize   = UDPChunkSize - chunkHeaderSize
+	maxChunks       = 128
+)
+
+type Transport uint8
+
+const (
+	TransportUDP Transport = iota
+	TransportTCP
+	TransportTLS
+)
+
+type Compression uint8
+
+const (
+	CompressNone Compression = iota
+	CompressGzip
+	CompressZlib
+)
+
+var (
+	chunkMagic = []byte{0x1e, 0x0f}
+
+	ErrMessageTooLarge = errors.New("gelf: message too large, exceeds 128 chunks")
+)
+
+const dialTimeout = 5 * time.Second
+
+var ErrReservedField = errors.New("gelf: _id is reserved by Graylog")
+
+// standardFields are the GELF 1.1 fields that are sent without the "_" prefix.
+var standardFields = map[string]bool{
+	"version":       true,
+	"host":          true,
+	"short_message": true,
+	"full_message":  true,
+	"timestamp":     true,
+	"level":         true,
+}
+
+// Syslog severity levels used by the GELF level field
+const (
+	syslogAlert    = 1
+	syslogCritical = 2
+	syslogError    = 3
+	syslogWarning  = 4
+	syslogInfo     = 6
+	syslogDebug    = 7
 )
 
+func syslogLevel(level LogLevel) int {
+	switch level {
+	case DEBUG:
+		return syslogDebug
+	case INFO:
+		return syslogInfo
+	case WARN:
+		return syslogWarning
+	case ERROR:
+		return syslogError
+	case PANIC:
+		return syslogCritical
+	}
+	return syslogAlert
+}
+
+// recordFieldKey prefixes every record field with "_", so fields such as version or host
+// never replace the standard GELF fields.
+func recordFieldKey(key string) (string, error) {
+	if !strings.HasPrefix(key, "_") {
+		key = "_" + key
+	}
+	if key == "_id" {
+		return "", ErrReservedField
+	}
+	return key, nil
+}
+
+// fieldKey prefixes additional fields with "_" as required by GELF 1.1, properties may
+// still set the standard fields.
+func fieldKey(key string) (string, error) {
+	if standardFields[key] {
+		return key, nil
+	}
+	return recordFieldKey(key)
+}
+
+func gelfTimestamp(t time.Time) float64 {
+	return float64(t.UnixNano()/int64(time.Millisecond)) / 1000
+}
+
+func baseProperty() map[string]interface{} {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return map[string]interface{}{"version": "1.1", "host": host}
+}
+
+// fullMessage puts the error in front of the stack trace of r.
+func fullMessage(r *Record) string {
+	if r.Err == nil {
+		return r.Message + "\n\n" + r.Stack
+	}
+	return r.Message + ": " + r.Err.Error() + "\n\n" + r.Stack
+}
+
+// fieldValue converts value to a string or a number, the types of GELF additional fields.
+// Anything else would encode as {}, e.g. an error, or fail the whole message, e.g. a func or NaN.
+func fieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return fmt.Sprint(v)
+		}
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v)
+		}
+		return v
+	case error:
+		return v.Error()
+	}
+	return fmt.Sprint(value)
+}
+
+// encodeMessage builds a fresh GELF payload for r on top of the handler properties.
+func encodeMessage(property map[string]interface{}, r *Record) ([]byte, error) {
+	message := make(map[string]interface{}, len(property)+len(r.Fields)+3)
+	for key, value := range property {
+		message[key] = value
+	}
+	for key, value := range r.Fields {
+		if key, err := recordFieldKey(key); err == nil {
+			message[key] = fieldValue(value)
+		}
+	}
+	if r.Logger != "" {
+		message["_logger"] = r.Logger
+	}
+	if r.Caller.File != "" {
+		message["_file"] = r.Caller.File
+		message["_line"] = r.Caller.Line
+		message["_function"] = r.Caller.Function
+	}
+	message["level"] = syslogLevel(r.Level)
+	message["timestamp"] = gelfTimestamp(r.Time)
+	message["short_message"] = r.Message
+	if r.Err != nil {
+		message["_error"] = errorChain(r.Err)
+	}
+	if r.Stack != "" {
+		message["full_message"] = fullMessage(r)
+	}
+	return json.Marshal(message)
+}
+
 type GELFHandler struct {
-	server 	string
-	port   	int
-	conn    *net.UDPConn
+	baseHandler
+	server      string
+	port        int
+	conn        net.Conn
+	transport   Transport
+	tlsConfig   *tls.Config
+	caFile      string
+	certFile    string
+	keyFile     string
+	compression Compression
+
+	spoolDir     string
+	spoolMemSize int
+	spoolMaxDisk int64
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	spool        *spool
+	wakeup       chan struct{}
+	done         chan struct{}
+	stopped      chan struct{}
+	closeOnce    sync.Once
+
+	mu          sync.Mutex
 	logProperty map[string]interface{}
 }
 
-func NewGELFHandler(server string, port int) *GELFHandler {
-	baseProperty := map[string]interface{}{"version": "1.1"}
-	return &GELFHandler{server: server, port: port, logProperty: baseProperty}
+type GELFOption func(g *GELFHandler)
+
+// WithCompression compresses every payload before it is sent, Graylog detects the format by its magic bytes.
+func WithCompression(compression Compression) GELFOption {
+	return func(g *GELFHandler) {
+		g.compression = compression
+	}
 }
 
-func (g *GELFHandler) name() string {
-	return "gelf"
+func WithTransport(transport Transport) GELFOption {
+	return func(g *GELFHandler) {
+		g.transport = transport
+	}
 }
 
-func (g *GELFHandler) setLevel(level LogLevel) {
-	g.AddProperty("level", level)
+func WithTLSConfig(config *tls.Config) GELFOption {
+	return func(g *GELFHandler) {
+		g.transport = TransportTLS
+		g.tlsConfig = config
+	}
+}
+
+// WithTLSFiles uses a custom CA and an optional client certificate, the files are loaded on first connect.
+func WithTLSFiles(caFile, certFile, keyFile string) GELFOption {
+	return func(g *GELFHandler) {
+		g.transport = TransportTLS
+		g.caFile = caFile
+		g.certFile = certFile
+		g.keyFile = keyFile
+	}
 }
 
-func (g *GELFHandler) AddProperty(key string, value interface{}) {
+func NewGELFHandler(server string, port int, opts ...GELFOption) *GELFHandler {
+	g := &GELFHandler{
+		server:      server,
+		port:        port,
+		minBackoff:  defaultMinBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		logProperty: baseProperty(),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.spoolDir != "" {
+		g.startSpool()
+	}
+	return g
+}
+
+func (g *GELFHandler) name() string {
+	return "gelf"
+}
+
+// AddProperty adds a field to every message, keys other than the GELF standard fields get the "_" prefix.
+func (g *GELFHandler) AddProperty(key string, value interface{}) error {
+	key, err := fieldKey(key)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
 	g.logProperty[key] = value
+	g.mu.Unlock()
+	return nil
 }
 
-func (g *GELFHandler) write(msg string) {
-	logTime := time.Now().Format(timeFormat)
-	g.logProperty["time"] = logTime
-	g.logProperty["short_message"] = msg
-	jsonMsg := g.toJson()
-	if g.conn == nil {
-		g.connect()
+func (g *GELFHandler) write(r *Record) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	jsonMsg, err := encodeMessage(g.logProperty, r)
+	if err != nil {
+		fmt.Println("Parse JSON error ", err)
+		return
+	}
+	data, err := g.compress(jsonMsg)
+	if err != nil {
+		fmt.Println("Compress message error ", err)
+		return
 	}
-	if _, err := g.conn.Write(jsonMsg); err != nil {
+	// Keep the order, nothing is sent directly while older messages wait in the spool
+	if g.spool != nil && !g.spool.empty() {
+		g.enqueue(data)
+		return
+	}
+	if err := g.send(data); err != nil {
+		if g.spool != nil && err != ErrMessageTooLarge {
+			g.enqueue(data)
+			return
+		}
 		fmt.Println("Send message to server error ", err)
 	}
 }
 
-func (g *GELFHandler) toJson() []byte {
-	bytes, err := json.Marshal(g.logProperty)
+func (g *GELFHandler) compress(data []byte) ([]byte, error) {
+	// GELF over TCP does not support compression
+	if g.transport != TransportUDP {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch g.compression {
+	case CompressGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressZlib:
+		w = zlib.NewWriter(&buf)
+	default:
+		return data, nil
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *GELFHandler) send(data []byte) error {
+	if err := g.connect(); err != nil {
+		return err
+	}
+	err := g.sendOnce(data)
+	if err == nil || err == ErrMessageTooLarge {
+		return err
+	}
+	// The connection may be broken after a server restart, dial again and retry once.
+	g.close()
+	if err := g.connect(); err != nil {
+		return err
+	}
+	return g.sendOnce(data)
+}
+
+func (g *GELFHandler) sendOnce(data []byte) error {
+	if g.transport != TransportUDP {
+		// Stream transports delimit every message with a null byte
+		frame := make([]byte, len(data)+1)
+		copy(frame, data)
+		_, err := g.conn.Write(frame)
+		return err
+	}
+	if len(data) <= UDPChunkSize {
+		_, err := g.conn.Write(data)
+		return err
+	}
+	return g.sendChunked(data)
+}
+
+func (g *GELFHandler) sendChunked(data []byte) error {
+	count := (len(data) + chunkDataSize - 1) / chunkDataSize
+	if count > maxChunks {
+		return ErrMessageTooLarge
+	}
+	msgId := make([]byte, 8)
+	if _, err := rand.Read(msgId); err != nil {
+		return err
+	}
+	chunk := make([]byte, 0, UDPChunkSize)
+	for i := 0; i < count; i++ {
+		start := i * chunkDataSize
+		end := start + chunkDataSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk = append(chunk[:0], chunkMagic...)
+		chunk = append(chunk, msgId...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data[start:end]...)
+		if _, err := g.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GELFHandler) connect() error {
+	if g.conn != nil {
+		return nil
+	}
+	addr := fmt.Sprintf("%v:%v", g.server, g.port)
+	var conn net.Conn
+	var err error
+	switch g.transport {
+	case TransportTCP:
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	case TransportTLS:
+		var config *tls.Config
+		if config, err = g.loadTLSConfig(); err != nil {
+			return err
+		}
+		dialer := &net.Dialer{Timeout: dialTimeout}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, config)
+	default:
+		conn, err = net.DialTimeout("udp", addr, dialTimeout)
+	}
 	if err != nil {
-		fmt.Println("Parse JSON error ", err)
-		return bytes
+		return err
 	}
-	return bytes
+	g.conn = conn
+	return nil
 }
 
-func (g *GELFHandler) connect() {
-	if g.conn == nil {
-		addr := fmt.Sprintf("%v:%v", g.server, g.port)
-		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+func (g *GELFHandler) loadTLSConfig() (*tls.Config, error) {
+	if g.tlsConfig != nil {
+		return g.tlsConfig, nil
+	}
+	config := &tls.Config{ServerName: g.server}
+	if g.caFile != "" {
+		ca, err := ioutil.ReadFile(g.caFile)
 		if err != nil {
-			fmt.Println("Resolve failed ", err)
-			return
+			return nil, err
 		}
-		if conn, err := net.DialUDP("udp", nil, udpAddr); err != nil {
-			fmt.Println("Connect failed ", err)
-			return
-		} else {
-			g.conn = conn
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("gelf: no certificate found in %v", g.caFile)
 		}
+		config.RootCAs = pool
 	}
-}
\ No newline at end of file
+	if g.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(g.certFile, g.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	g.tlsConfig = config
+	return config, nil
+}
+
+func (g *GELFHandler) close() {
+	if g.conn != nil {
+		_ = g.conn.Close()
+		g.conn = nil
+	}
+}
@@ -1,16 +1,319 @@
 package gelf
 
 import (
-	"fmt"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"goutils/gelf/gelftest"
 )
 
 func TestNewGELFHandler(t *testing.T) {
-	server := "172.18.61.78"
-	port := 12202
+	server, err := gelftest.NewUDPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
 	msg := `test msg`
-	fmt.Println(len(msg))
-	gelf := NewGELFHandler(server, port)
+	gelf := NewGELFHandler(server.Host(), server.Port())
 	gelf.AddProperty("source", "cheng-pc5")
-	gelf.write(msg)
+	gelf.write(testRecord(INFO, msg))
+	messages, err := server.WaitMessages(1, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages[0].ShortMessage != msg || messages[0].Extra["_source"] != "cheng-pc5" {
+		t.Errorf("unexpected message %+v", messages[0])
+	}
+}
+
+func testRecord(level LogLevel, msg string) *Record {
+	return &Record{Level: level, Time: time.Now(), Message: msg}
+}
+
+func listenUDP(t *testing.T) (*net.UDPConn, int) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func readChunked(t *testing.T, conn *net.UDPConn) []byte {
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	chunks := make(map[int][]byte)
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packet := buf[:n]
+		if !bytes.HasPrefix(packet, chunkMagic) {
+			return append([]byte(nil), packet...)
+		}
+		if n > UDPChunkSize {
+			t.Fatalf("chunk size %d exceeds %d", n, UDPChunkSize)
+		}
+		seq, count := int(packet[10]), int(packet[11])
+		chunks[seq] = append([]byte(nil), packet[chunkHeaderSize:]...)
+		if len(chunks) == count {
+			var data []byte
+			for i := 0; i < count; i++ {
+				data = append(data, chunks[i]...)
+			}
+			return data
+		}
+	}
+}
+
+func TestGELFHandlerChunking(t *testing.T) {
+	conn, port := listenUDP(t)
+	defer conn.Close()
+	msg := strings.Repeat("stack trace line\n", 500)
+	gelf := NewGELFHandler("127.0.0.1", port)
+	gelf.write(testRecord(INFO, msg))
+	var property map[string]interface{}
+	if err := json.Unmarshal(readChunked(t, conn), &property); err != nil {
+		t.Fatal(err)
+	}
+	if property["short_message"] != msg {
+		t.Errorf("reassembled message mismatch, got %d bytes", len(property["short_message"].(string)))
+	}
+}
+
+func TestGELFHandlerMessageTooLarge(t *testing.T) {
+	conn, port := listenUDP(t)
+	defer conn.Close()
+	gelf := NewGELFHandler("127.0.0.1", port)
+	data := make([]byte, chunkDataSize*maxChunks+1)
+	if err := gelf.send(data); err != ErrMessageTooLarge {
+		t.Errorf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+// randomText returns hardly compressible text so compressed payloads still need chunking.
+func randomText(n int) string {
+	r := rand.New(rand.NewSource(1))
+	letters := "abcdefghijklmnopqrstuvwxyz0123456789"
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = letters[r.Intn(len(letters))]
+	}
+	return string(buf)
+}
+
+func TestGELFHandlerCompression(t *testing.T) {
+	tests := []struct {
+		compression Compression
+		magic       []byte
+		reader      func(r io.Reader) (io.Reader, error)
+	}{
+		{CompressGzip, []byte{0x1f, 0x8b}, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{CompressZlib, []byte{0x78}, func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+	}
+	for _, tt := range tests {
+		conn, port := listenUDP(t)
+		msg := randomText(8000)
+		gelf := NewGELFHandler("127.0.0.1", port, WithCompression(tt.compression))
+		gelf.AddProperty("source", "test")
+		gelf.write(testRecord(INFO, msg))
+		data := readChunked(t, conn)
+		_ = conn.Close()
+		if !bytes.HasPrefix(data, tt.magic) {
+			t.Fatalf("compression %d: unexpected magic bytes %x", tt.compression, data[:2])
+		}
+		r, err := tt.reader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var property map[string]interface{}
+		if err := json.NewDecoder(r).Decode(&property); err != nil {
+			t.Fatal(err)
+		}
+		if property["short_message"] != msg || property["_source"] != "test" {
+			t.Errorf("compression %d: decoded message mismatch", tt.compression)
+		}
+	}
+}
+
+func readFrame(t *testing.T, conn net.Conn) map[string]interface{} {
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	frame, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var property map[string]interface{}
+	if err := json.Unmarshal(frame[:len(frame)-1], &property); err != nil {
+		t.Fatal(err)
+	}
+	return property
+}
+
+func TestGELFHandlerTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+	gelf := NewGELFHandler("127.0.0.1", port, WithTransport(TransportTCP))
+	gelf.write(testRecord(INFO, "first"))
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if property := readFrame(t, conn); property["short_message"] != "first" {
+		t.Errorf("unexpected message %v", property["short_message"])
+	}
+	// Simulate a Graylog restart, the handler must dial a new connection.
+	_ = conn.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		gelf.write(testRecord(INFO, "after restart"))
+		select {
+		case conn := <-accepted:
+			defer conn.Close()
+			if property := readFrame(t, conn); property["short_message"] != "after restart" {
+				t.Errorf("unexpected message %v", property["short_message"])
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	t.Fatal("handler did not reconnect")
+}
+
+func TestGELFHandlerTLS(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+	gelf := NewGELFHandler("127.0.0.1", port, WithTLSConfig(&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}))
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		// The client blocks in dial until the handshake is done
+		_ = conn.(*tls.Conn).Handshake()
+		accepted <- conn
+	}()
+	gelf.write(testRecord(INFO, "over tls"))
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+		if property := readFrame(t, conn); property["short_message"] != "over tls" {
+			t.Errorf("unexpected message %v", property["short_message"])
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no connection accepted")
+	}
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gelf test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(crand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestGELFHandlerSpecFields(t *testing.T) {
+	conn, port := listenUDP(t)
+	defer conn.Close()
+	gelf := NewGELFHandler("127.0.0.1", port)
+	if err := gelf.AddProperty("source", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gelf.AddProperty("_env", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gelf.AddProperty("id", 1); err != ErrReservedField {
+		t.Errorf("expected ErrReservedField, got %v", err)
+	}
+	before := time.Now()
+	r := testRecord(WARN, "spec")
+	r.Fields = map[string]interface{}{"user": "tom", "id": 2}
+	gelf.write(r)
+	var property map[string]interface{}
+	if err := json.Unmarshal(readChunked(t, conn), &property); err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	if property["version"] != "1.1" || property["host"] != host {
+		t.Errorf("unexpected version or host in %v", property)
+	}
+	if property["level"] != float64(syslogWarning) {
+		t.Errorf("expected level %d, got %v", syslogWarning, property["level"])
+	}
+	if property["_source"] != "test" || property["_env"] != "dev" || property["source"] != nil || property["_user"] != "tom" {
+		t.Errorf("additional fields must be prefixed once, got %v", property)
+	}
+	timestamp, ok := property["timestamp"].(float64)
+	if !ok || timestamp < float64(before.Unix()) || timestamp > float64(time.Now().Unix()+1) {
+		t.Errorf("unexpected timestamp %v", property["timestamp"])
+	}
+	if _, ok := property["time"]; ok {
+		t.Error("time is not a GELF field")
+	}
+	if _, ok := property["_id"]; ok {
+		t.Error("_id must not be sent")
+	}
+}
+
+func TestSyslogLevel(t *testing.T) {
+	levels := map[LogLevel]int{DEBUG: 7, INFO: 6, WARN: 4, ERROR: 3}
+	for level, severity := range levels {
+		if got := syslogLevel(level); got != severity {
+			t.Errorf("level %d: expected severity %d, got %d", level, severity, got)
+		}
+	}
 }
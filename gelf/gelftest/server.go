@@ -0,0 +1,340 @@
+// Package gelftest provides an in-process GELF server for tests, so handlers
+// and user code can be tested without a Graylog instance.
+package gelftest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	chunkHeaderSize = 12
+	maxChunks       = 128
+	// GELF receivers drop incomplete chunked messages after 5 seconds
+	chunkTimeout = 5 * time.Second
+	maxDatagram  = 65535
+	pollInterval = 5 * time.Millisecond
+	defaultLevel = 1
+)
+
+// Message is a received GELF message, additional fields are kept in Extra with their "_" prefix.
+type Message struct {
+	Version      string
+	Host         string
+	ShortMessage string
+	FullMessage  string
+	Timestamp    float64
+	Level        int
+	Extra        map[string]interface{}
+}
+
+type chunkSet struct {
+	chunks   [][]byte
+	received int
+	first    time.Time
+}
+
+// Server receives GELF messages over UDP or TCP on a random local port.
+type Server struct {
+	udp      *net.UDPConn
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []Message
+	errs     []error
+	chunks   map[string]*chunkSet
+	conns    map[net.Conn]bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewUDPServer listens on 127.0.0.1 and reassembles chunked and compressed messages.
+func NewUDPServer() (*Server, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{udp: conn, chunks: make(map[string]*chunkSet)}
+	s.wg.Add(1)
+	go s.serveUDP()
+	return s, nil
+}
+
+// NewTCPServer listens on 127.0.0.1 and reads null byte delimited messages.
+func NewTCPServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: listener, conns: make(map[net.Conn]bool)}
+	s.wg.Add(1)
+	go s.serveTCP()
+	return s, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	if s.udp != nil {
+		return s.udp.LocalAddr()
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) Host() string {
+	return "127.0.0.1"
+}
+
+func (s *Server) Port() int {
+	if s.udp != nil {
+		return s.udp.LocalAddr().(*net.UDPAddr).Port
+	}
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Messages returns the messages received so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]Message, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// Errors returns the payloads that could not be decoded.
+func (s *Server) Errors() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := make([]error, len(s.errs))
+	copy(errs, s.errs)
+	return errs
+}
+
+// WaitMessages waits until at least n messages are received.
+func (s *Server) WaitMessages(n int, timeout time.Duration) ([]Message, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		messages := s.Messages()
+		if len(messages) >= n {
+			return messages, nil
+		}
+		if time.Now().After(deadline) {
+			return messages, fmt.Errorf("gelftest: received %d of %d messages", len(messages), n)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Reset forgets the received messages and errors.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	s.messages = nil
+	s.errs = nil
+	s.mu.Unlock()
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	var err error
+	if s.udp != nil {
+		err = s.udp.Close()
+	} else {
+		err = s.listener.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := s.udp.Read(buf)
+		if err != nil {
+			return
+		}
+		packet := append([]byte(nil), buf[:n]...)
+		if len(packet) >= 2 && packet[0] == 0x1e && packet[1] == 0x0f {
+			if payload := s.addChunk(packet); payload != nil {
+				s.receive(payload)
+			}
+			continue
+		}
+		s.receive(packet)
+	}
+}
+
+// addChunk returns the reassembled payload once every chunk of a message is received.
+func (s *Server) addChunk(packet []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(packet) < chunkHeaderSize {
+		s.errs = append(s.errs, errors.New("gelftest: short chunk"))
+		return nil
+	}
+	id := string(packet[2:10])
+	seq, count := int(packet[10]), int(packet[11])
+	if count == 0 || count > maxChunks || seq >= count {
+		s.errs = append(s.errs, fmt.Errorf("gelftest: invalid chunk %d of %d", seq, count))
+		return nil
+	}
+	now := time.Now()
+	for key, set := range s.chunks {
+		if now.Sub(set.first) > chunkTimeout {
+			delete(s.chunks, key)
+		}
+	}
+	set, ok := s.chunks[id]
+	if !ok {
+		set = &chunkSet{chunks: make([][]byte, count), first: now}
+		s.chunks[id] = set
+	}
+	if seq >= len(set.chunks) || set.chunks[seq] != nil {
+		return nil
+	}
+	set.chunks[seq] = packet[chunkHeaderSize:]
+	set.received++
+	if set.received < len(set.chunks) {
+		return nil
+	}
+	delete(s.chunks, id)
+	return bytes.Join(set.chunks, nil)
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := reader.ReadBytes(0)
+		if len(frame) > 1 {
+			s.receive(bytes.TrimSuffix(frame, []byte{0}))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) receive(payload []byte) {
+	message, err := Decode(payload)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errs = append(s.errs, err)
+		return
+	}
+	s.messages = append(s.messages, message)
+}
+
+// Decode parses a GELF payload, which may be gzip or zlib compressed.
+func Decode(payload []byte) (Message, error) {
+	data, err := decompress(payload)
+	if err != nil {
+		return Message{}, err
+	}
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return Message{}, err
+	}
+	message := Message{Level: defaultLevel, Extra: make(map[string]interface{})}
+	for key, value := range fields {
+		switch key {
+		case "version":
+			message.Version = fmt.Sprint(value)
+		case "host":
+			message.Host = fmt.Sprint(value)
+		case "short_message":
+			message.ShortMessage = fmt.Sprint(value)
+		case "full_message":
+			message.FullMessage = fmt.Sprint(value)
+		case "timestamp":
+			if number, ok := value.(json.Number); ok {
+				message.Timestamp, _ = number.Float64()
+			}
+		case "level":
+			if number, ok := value.(json.Number); ok {
+				level, _ := number.Int64()
+				message.Level = int(level)
+			}
+		default:
+			if !strings.HasPrefix(key, "_") {
+				return Message{}, fmt.Errorf("gelftest: additional field %q is not prefixed with _", key)
+			}
+			message.Extra[key] = plainNumber(value)
+		}
+	}
+	return message, nil
+}
+
+func decompress(payload []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch {
+	case len(payload) >= 2 && payload[0] == 0x1f && payload[1] == 0x8b:
+		r, err = gzip.NewReader(bytes.NewReader(payload))
+	case len(payload) >= 2 && payload[0] == 0x78 && (uint16(payload[0])<<8|uint16(payload[1]))%31 == 0:
+		r, err = zlib.NewReader(bytes.NewReader(payload))
+	default:
+		return payload, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// plainNumber turns json.Number into int64 or float64, so Extra compares like regular Go values.
+func plainNumber(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	f, _ := number.Float64()
+	return f
+}
@@ -0,0 +1,71 @@
+package gelftest_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"goutils/gelf"
+	"goutils/gelf/gelftest"
+)
+
+func TestUDPServer(t *testing.T) {
+	for _, compression := range []gelf.Compression{gelf.CompressNone, gelf.CompressGzip, gelf.CompressZlib} {
+		server, err := gelftest.NewUDPServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		log := gelf.New("test")
+		log.AddHandlers(gelf.NewGELFHandler(server.Host(), server.Port(), gelf.WithCompression(compression)))
+		long := strings.Repeat("0123456789abcdefghijklmnopqrstuvwxyz", 200)
+		log.Infow("short", "user", "tom", "count", 3)
+		log.Error(long)
+
+		messages, err := server.WaitMessages(2, 3*time.Second)
+		_ = server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messages[0].ShortMessage != "short" || messages[0].Level != 6 || messages[0].Version != "1.1" {
+			t.Errorf("compression %d: unexpected message %+v", compression, messages[0])
+		}
+		if messages[0].Extra["_user"] != "tom" || messages[0].Extra["_count"] != int64(3) || messages[0].Extra["_logger"] != "test" {
+			t.Errorf("compression %d: unexpected fields %v", compression, messages[0].Extra)
+		}
+		if messages[1].ShortMessage != long || messages[1].Level != 3 {
+			t.Errorf("compression %d: chunked message was not reassembled", compression)
+		}
+		if len(server.Errors()) != 0 {
+			t.Errorf("compression %d: unexpected errors %v", compression, server.Errors())
+		}
+	}
+}
+
+func TestTCPServer(t *testing.T) {
+	server, err := gelftest.NewTCPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	log := gelf.New("")
+	log.AddHandlers(gelf.NewGELFHandler(server.Host(), server.Port(), gelf.WithTransport(gelf.TransportTCP)))
+	log.Warn("first")
+	log.Warn("second")
+	messages, err := server.WaitMessages(2, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages[0].ShortMessage != "first" || messages[1].ShortMessage != "second" || messages[1].Level != 4 {
+		t.Errorf("unexpected messages %+v", messages)
+	}
+	server.Reset()
+	if len(server.Messages()) != 0 {
+		t.Error("Reset must forget the messages")
+	}
+}
+
+func TestDecodeRejectsUnprefixedFields(t *testing.T) {
+	if _, err := gelftest.Decode([]byte(`{"version":"1.1","short_message":"x","user":"tom"}`)); err == nil {
+		t.Error("expected an error for an unprefixed additional field")
+	}
+}
@@ -0,0 +1,299 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 1
+	defaultFlushInterval = time.Second
+	defaultMaxPending    = 10000
+	defaultMaxRetries    = 3
+	defaultRetryBackoff  = 200 * time.Millisecond
+	httpTimeout          = 10 * time.Second
+)
+
+// GELFHTTPHandler posts messages to a Graylog GELF HTTP input, e.g. http://graylog:12201/gelf
+type GELFHTTPHandler struct {
+	baseHandler
+	url           string
+	client        *http.Client
+	batchSize     int
+	flushInterval time.Duration
+	gzip          bool
+	username      string
+	password      string
+	headers       map[string]string
+	maxRetries    int
+	retryBackoff  time.Duration
+	logProperty   map[string]interface{}
+
+	mu         sync.Mutex
+	batch      [][]byte
+	maxPending int
+	dropped    uint64
+	// sendMu keeps the batches in order when Flush and the flush loop post at the same time
+	sendMu    sync.Mutex
+	startOnce sync.Once
+	wakeup    chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type HTTPOption func(h *GELFHTTPHandler)
+
+// WithBatchSize sends up to size newline delimited messages per request, 1 by default,
+// the Graylog input must have bulk receiving enabled when size is greater than 1.
+func WithBatchSize(size int) HTTPOption {
+	return func(h *GELFHTTPHandler) {
+		if size > 0 {
+			h.batchSize = size
+		}
+	}
+}
+
+// WithFlushInterval sends the pending messages after interval, a full batch is sent right away.
+func WithFlushInterval(interval time.Duration) HTTPOption {
+	return func(h *GELFHTTPHandler) {
+		if interval > 0 {
+			h.flushInterval = interval
+		}
+	}
+}
+
+// WithMaxPending keeps at most size messages waiting to be sent, newer messages are dropped
+// while the Graylog input is slow or down.
+func WithMaxPending(size int) HTTPOption {
+	return func(h *GELFHTTPHandler) {
+		if size > 0 {
+			h.maxPending = size
+		}
+	}
+}
+
+func WithGzip() HTTPOption {
+	return func(h *GELFHTTPHandler) {
+		h.gzip = true
+	}
+}
+
+func WithBasicAuth(username, password string) HTTPOption {
+	return func(h *GELFHTTPHandler) {
+		h.username = username
+		h.password = password
+	}
+}
+
+func WithHeader(key, value string) HTTPOption {
+	return func(h *GELFHTTPHandler) {
+		h.headers[key] = value
+	}
+}
+
+// WithRetry retries 5xx responses and network errors maxRetries times, the backoff doubles on every attempt.
+func WithRetry(maxRetries int, backoff time.Duration) HTTPOption {
+	return func(h *GELFHTTPHandler) {
+		h.maxRetries = maxRetries
+		h.retryBackoff = backoff
+	}
+}
+
+func WithHTTPClient(client *http.Client) HTTPOption {
+	return func(h *GELFHTTPHandler) {
+		h.client = client
+	}
+}
+
+func NewGELFHTTPHandler(url string, opts ...HTTPOption) *GELFHTTPHandler {
+	h := &GELFHTTPHandler{
+		url:           url,
+		client:        &http.Client{Timeout: httpTimeout},
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		headers:       make(map[string]string),
+		maxRetries:    defaultMaxRetries,
+		retryBackoff:  defaultRetryBackoff,
+		logProperty:   baseProperty(),
+		maxPending:    defaultMaxPending,
+		wakeup:        make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *GELFHTTPHandler) name() string {
+	return "gelf-http"
+}
+
+func (h *GELFHTTPHandler) AddProperty(key string, value interface{}) error {
+	key, err := fieldKey(key)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.logProperty[key] = value
+	h.mu.Unlock()
+	return nil
+}
+
+// write only queues the message, the flush loop posts it so a slow input never blocks the caller.
+func (h *GELFHTTPHandler) write(r *Record) {
+	h.startOnce.Do(func() {
+		go h.flushLoop()
+	})
+	h.mu.Lock()
+	jsonMsg, err := encodeMessage(h.logProperty, r)
+	if err != nil {
+		h.mu.Unlock()
+		fmt.Println("Parse JSON error ", err)
+		return
+	}
+	if len(h.batch) >= h.maxPending {
+		h.dropped++
+		h.mu.Unlock()
+		return
+	}
+	h.batch = append(h.batch, jsonMsg)
+	full := len(h.batch) >= h.batchSize
+	h.mu.Unlock()
+	if full {
+		select {
+		case h.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *GELFHTTPHandler) flushLoop() {
+	ticker := time.NewTicker(h.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.wakeup:
+		case <-h.done:
+			return
+		}
+		if err := h.Flush(); err != nil {
+			fmt.Println("Send message to server error ", err)
+		}
+	}
+}
+
+// Flush sends the pending messages in batches of the batch size. It stops at a batch that
+// fails after its retries, the batch is dropped and the later messages wait for the next flush.
+func (h *GELFHTTPHandler) Flush() error {
+	h.sendMu.Lock()
+	defer h.sendMu.Unlock()
+	h.mu.Lock()
+	pending := h.batch
+	h.batch = nil
+	h.mu.Unlock()
+	for len(pending) > 0 {
+		n := h.batchSize
+		if n > len(pending) {
+			n = len(pending)
+		}
+		body, err := h.encode(pending[:n])
+		if err == nil {
+			err = h.post(body)
+		}
+		pending = pending[n:]
+		if err != nil {
+			h.mu.Lock()
+			h.dropped += uint64(n)
+			h.batch = append(pending, h.batch...)
+			h.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of messages lost because too many were pending or their batch failed.
+func (h *GELFHTTPHandler) Dropped() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// Close stops the flush loop and sends the pending batch.
+func (h *GELFHTTPHandler) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+	return h.Flush()
+}
+
+func (h *GELFHTTPHandler) encode(batch [][]byte) ([]byte, error) {
+	body := bytes.Join(batch, []byte("\n"))
+	if !h.gzip {
+		return body, nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *GELFHTTPHandler) post(body []byte) error {
+	backoff := h.retryBackoff
+	var err error
+	for attempt := 0; attempt <= h.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var retry bool
+		if retry, err = h.postOnce(body); !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// postOnce reports whether the request failed in a way that is worth retrying.
+func (h *GELFHTTPHandler) postOnce(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if h.username != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+	for key, value := range h.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return true, fmt.Errorf("gelf: %v responded %v", h.url, resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("gelf: %v responded %v", h.url, resp.Status)
+	}
+	return false, nil
+}
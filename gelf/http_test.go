@@ -0,0 +1,144 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGELFHTTPHandler(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "graylog" || pass != "secret" {
+			t.Errorf("unexpected basic auth %v %v", user, pass)
+		}
+		if r.Header.Get("X-Env") != "test" {
+			t.Errorf("missing custom header")
+		}
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("body is not gzipped")
+		}
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		body, _ := ioutil.ReadAll(gr)
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	handler := NewGELFHTTPHandler(server.URL+"/gelf",
+		WithBatchSize(2),
+		WithGzip(),
+		WithBasicAuth("graylog", "secret"),
+		WithHeader("X-Env", "test"),
+		WithRetry(2, time.Millisecond),
+	)
+	handler.AddProperty("source", "test")
+	handler.write(testRecord(INFO, "first"))
+	handler.write(testRecord(INFO, "second"))
+	handler.write(testRecord(INFO, "third"))
+	if err := handler.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 || len(bodies) != 2 {
+		t.Fatalf("expected 1 retry and 2 batches, got %d calls and %d batches", calls, len(bodies))
+	}
+	var messages []string
+	for _, body := range bodies {
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			var property map[string]interface{}
+			if err := json.Unmarshal(line, &property); err != nil {
+				t.Fatal(err)
+			}
+			if property["_source"] != "test" {
+				t.Errorf("missing property in %s", line)
+			}
+			messages = append(messages, property["short_message"].(string))
+		}
+	}
+	if len(messages) != 3 || messages[0] != "first" || messages[2] != "third" {
+		t.Errorf("unexpected messages %v", messages)
+	}
+}
+
+func TestGELFHTTPHandlerClientError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	handler := NewGELFHTTPHandler(server.URL+"/gelf", WithRetry(3, time.Millisecond))
+	handler.batch = [][]byte{[]byte(`{}`)}
+	if err := handler.Flush(); err == nil {
+		t.Error("expected an error for 400 response")
+	}
+	if calls != 1 {
+		t.Errorf("4xx responses must not be retried, got %d calls", calls)
+	}
+	if handler.Dropped() != 1 {
+		t.Errorf("expected the failed message to be dropped, got %d", handler.Dropped())
+	}
+}
+
+func TestGELFHTTPHandlerDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	handler := NewGELFHTTPHandler(server.URL+"/gelf", WithMaxPending(3))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		handler.write(testRecord(INFO, "message"))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("write waited %v for the server", elapsed)
+	}
+	close(release)
+	if err := handler.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// The default batch size posts every message on its own
+	sent := len(bodies)
+	if sent < 3 || uint64(sent)+handler.Dropped() != 5 {
+		t.Errorf("expected 5 messages sent or dropped, got %d sent and %d dropped", sent, handler.Dropped())
+	}
+	for _, body := range bodies {
+		if bytes.Contains([]byte(body), []byte("\n")) {
+			t.Errorf("expected one message per request, got %q", body)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package gelf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// levelPayload is the body of the level endpoint, levels are lowercase names such as "debug".
+type levelPayload struct {
+	Level    string            `json:"level,omitempty"`
+	Handler  string            `json:"handler,omitempty"`
+	Handlers map[string]string `json:"handlers,omitempty"`
+}
+
+type levelHandler struct {
+	log *Log
+}
+
+// NewLevelHandler returns an http.Handler that reports the levels of l on GET and changes
+// them on PUT, e.g. mounted on an admin port or with gin.WrapH:
+//
+//	curl localhost:8080/log/level
+//	{"level":"info","handlers":{"console":"debug","gelf":"warn"}}
+//	curl -X PUT -d '{"level":"debug"}' localhost:8080/log/level
+//	curl -X PUT -d '{"handler":"gelf","level":"info"}' localhost:8080/log/level
+//
+// PUT also accepts the form values level and handler. Levels are atomic, so changes are
+// safe while other goroutines log.
+func NewLevelHandler(l *Log) http.Handler {
+	return &levelHandler{log: l}
+}
+
+func (h *levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		payload, err := decodeLevelPayload(r)
+		if err != nil {
+			writeLevelError(w, http.StatusBadRequest, err)
+			return
+		}
+		level, err := ParseLevel(payload.Level)
+		if err != nil {
+			writeLevelError(w, http.StatusBadRequest, err)
+			return
+		}
+		if payload.Handler == "" {
+			h.log.SetLevel(level)
+		} else if err := h.log.SetHandlerLevel(payload.Handler, level); err != nil {
+			writeLevelError(w, http.StatusNotFound, err)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeLevelError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	payload := levelPayload{Level: levelName(h.log.Level()), Handlers: make(map[string]string)}
+	for name, level := range h.log.HandlerLevels() {
+		payload.Handlers[name] = levelName(level)
+	}
+	writeLevelJSON(w, http.StatusOK, payload)
+}
+
+func decodeLevelPayload(r *http.Request) (levelPayload, error) {
+	var payload levelPayload
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		payload.Level = r.FormValue("level")
+		payload.Handler = r.FormValue("handler")
+		return payload, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return payload, fmt.Errorf("decode body: %w", err)
+	}
+	return payload, nil
+}
+
+func levelName(level LogLevel) string {
+	return strings.ToLower(level.String())
+}
+
+func writeLevelError(w http.ResponseWriter, status int, err error) {
+	writeLevelJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeLevelJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("Write level response error ", err)
+	}
+}
+
+// levelGetter is implemented by the handlers that embed baseHandler.
+type levelGetter interface {
+	Level() LogLevel
+}
+
+// HandlerLevels returns the level of every handler that has one, by handler name.
+func (l *Log) HandlerLevels() map[string]LogLevel {
+	levels := make(map[string]LogLevel)
+	for _, handler := range l.core.list() {
+		name := handler.name()
+		for ; handler != nil; handler = unwrap(handler) {
+			if getter, ok := handler.(levelGetter); ok {
+				levels[name] = getter.Level()
+				break
+			}
+		}
+	}
+	return levels
+}
@@ -0,0 +1,97 @@
+package gelf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func levelRequest(t *testing.T, handler http.Handler, method, contentType, body string) (int, levelPayload) {
+	req := httptest.NewRequest(method, "/log/level", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var payload levelPayload
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, payload
+}
+
+func TestLevelHandler(t *testing.T) {
+	log, memory := newMemoryLog()
+	log.SetLevel(INFO)
+	memory.SetLevel(WARN)
+	handler := NewLevelHandler(log)
+
+	code, payload := levelRequest(t, handler, http.MethodGet, "", "")
+	if code != http.StatusOK || payload.Level != "info" || payload.Handlers["memory"] != "warn" {
+		t.Fatalf("unexpected response %d %+v", code, payload)
+	}
+	code, payload = levelRequest(t, handler, http.MethodPut, "application/json", `{"level":"debug"}`)
+	if code != http.StatusOK || payload.Level != "debug" || log.Level() != DEBUG {
+		t.Errorf("unexpected response %d %+v", code, payload)
+	}
+	form := url.Values{"handler": {"memory"}, "level": {"error"}}.Encode()
+	code, payload = levelRequest(t, handler, http.MethodPut, "application/x-www-form-urlencoded", form)
+	if code != http.StatusOK || payload.Handlers["memory"] != "error" || memory.Level() != ERROR {
+		t.Errorf("unexpected response %d %+v", code, payload)
+	}
+
+	tests := []struct {
+		method string
+		body   string
+		code   int
+	}{
+		{http.MethodPut, `{"level":"verbose"}`, http.StatusBadRequest},
+		{http.MethodPut, `not json`, http.StatusBadRequest},
+		{http.MethodPut, `{"handler":"missing","level":"info"}`, http.StatusNotFound},
+		{http.MethodPost, `{"level":"info"}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if code, _ := levelRequest(t, handler, tt.method, "application/json", tt.body); code != tt.code {
+			t.Errorf("%v %v: expected %d, got %d", tt.method, tt.body, tt.code, code)
+		}
+	}
+	if log.Level() != DEBUG || memory.Level() != ERROR {
+		t.Error("failed requests must not change levels")
+	}
+}
+
+func TestLevelHandlerConcurrent(t *testing.T) {
+	log, _ := newMemoryLog()
+	log.SetAsync(100, DropNewest)
+	defer log.Close()
+	handler := NewLevelHandler(log)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				log.Infow("request", "n", j)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for _, level := range []string{"debug", "warn", "info"} {
+				body := `{"level":"` + level + `"}`
+				if i%2 == 1 {
+					body = `{"handler":"memory","level":"` + level + `"}`
+				}
+				if code, _ := levelRequest(t, handler, http.MethodPut, "application/json", body); code != http.StatusOK {
+					t.Errorf("unexpected status %d", code)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,240 @@
+package gelf
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// repeatedField counts the records merged into a summary by the dedup window, GELF sends it as _repeated.
+const repeatedField = "repeated"
+
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+type rateConfig struct {
+	perSecond float64
+	burst     int
+}
+
+// tokenBucket holds up to burst tokens and refills perSecond tokens every second.
+type tokenBucket struct {
+	rateConfig
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b.last.IsZero() {
+		b.tokens = float64(b.burst)
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.perSecond
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type dedupKey struct {
+	level   LogLevel
+	logger  string
+	message string
+}
+
+// dedupEntry tracks one message from its first record until its window ends.
+type dedupEntry struct {
+	start    time.Time
+	repeated int
+	last     *Record
+}
+
+// Limiter wraps a handler, it drops records over a token bucket per level and merges
+// identical records within a window into one record with a repeated field.
+type Limiter struct {
+	handler LogHandler
+	clock   clock
+	rate    *rateConfig
+	rates   map[LogLevel]rateConfig
+	window  time.Duration
+
+	mu      sync.Mutex
+	buckets map[LogLevel]*tokenBucket
+	entries map[dedupKey]*dedupEntry
+	dropped uint64
+	done    chan struct{}
+	stopped chan struct{}
+	closed  bool
+}
+
+type LimiterOption func(*Limiter)
+
+// WithRateLimit lets through perSecond records of every level, with bursts of up to burst records.
+func WithRateLimit(perSecond float64, burst int) LimiterOption {
+	return func(l *Limiter) {
+		l.rate = &rateConfig{perSecond, burst}
+	}
+}
+
+// WithLevelRateLimit sets the token bucket of level, it overrides WithRateLimit for that level.
+func WithLevelRateLimit(level LogLevel, perSecond float64, burst int) LimiterOption {
+	return func(l *Limiter) {
+		l.rates[level] = rateConfig{perSecond, burst}
+	}
+}
+
+// WithDedup writes the first of identical records (same level, logger and message) and
+// suppresses the rest until window has passed, then writes the last one with
+// repeated set to the number of suppressed records.
+func WithDedup(window time.Duration) LimiterOption {
+	return func(l *Limiter) {
+		l.window = window
+	}
+}
+
+// NewLimiter wraps handler, e.g. log.AddHandlers(gelf.NewLimiter(gelfHandler, gelf.WithDedup(time.Minute))).
+func NewLimiter(handler LogHandler, opts ...LimiterOption) *Limiter {
+	l := newLimiter(handler, realClock{}, opts...)
+	if l.window > 0 {
+		l.done = make(chan struct{})
+		l.stopped = make(chan struct{})
+		go l.sweepLoop()
+	}
+	return l
+}
+
+func newLimiter(handler LogHandler, c clock, opts ...LimiterOption) *Limiter {
+	l := &Limiter{
+		handler: handler,
+		clock:   c,
+		rates:   make(map[LogLevel]rateConfig),
+		buckets: make(map[LogLevel]*tokenBucket),
+		entries: make(map[dedupKey]*dedupEntry),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	for level := DEBUG; level <= FATAL; level++ {
+		if config, ok := l.rates[level]; ok {
+			l.buckets[level] = &tokenBucket{rateConfig: config}
+		} else if l.rate != nil {
+			l.buckets[level] = &tokenBucket{rateConfig: *l.rate}
+		}
+	}
+	return l
+}
+
+func (l *Limiter) name() string {
+	return l.handler.name()
+}
+
+func (l *Limiter) enabled(r *Record) bool {
+	return l.handler.enabled(r)
+}
+
+func (l *Limiter) write(r *Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.sweep(now, false)
+	if l.window > 0 {
+		key := dedupKey{r.Level, r.Logger, r.Message}
+		if entry, ok := l.entries[key]; ok {
+			entry.repeated++
+			entry.last = r
+			return
+		}
+		l.entries[key] = &dedupEntry{start: now}
+	}
+	if bucket, ok := l.buckets[r.Level]; ok && !bucket.allow(now) {
+		l.dropped++
+		return
+	}
+	l.handler.write(r)
+}
+
+// sweep ends the windows that are over, or all of them, and writes their summaries. l.mu must be held.
+func (l *Limiter) sweep(now time.Time, all bool) {
+	for key, entry := range l.entries {
+		if !all && now.Sub(entry.start) < l.window {
+			continue
+		}
+		delete(l.entries, key)
+		if entry.repeated > 0 {
+			l.handler.write(summary(entry))
+		}
+	}
+}
+
+// summary copies the last suppressed record and adds the repeated count.
+func summary(entry *dedupEntry) *Record {
+	r := *entry.last
+	r.Fields = mergeFields(entry.last.Fields, []interface{}{repeatedField, entry.repeated})
+	return &r
+}
+
+func (l *Limiter) sweepLoop() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			l.sweep(l.clock.Now(), false)
+			l.mu.Unlock()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Dropped returns the number of records dropped by the token buckets.
+func (l *Limiter) Dropped() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropped
+}
+
+// Flush writes the summaries of all open windows and flushes the wrapped handler.
+func (l *Limiter) Flush() error {
+	l.mu.Lock()
+	l.sweep(l.clock.Now(), true)
+	l.mu.Unlock()
+	if f, ok := l.handler.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close writes the pending summaries and closes the wrapped handler.
+func (l *Limiter) Close() error {
+	l.mu.Lock()
+	if l.done != nil && !l.closed {
+		close(l.done)
+	}
+	l.closed = true
+	l.mu.Unlock()
+	if l.stopped != nil {
+		<-l.stopped
+	}
+	l.mu.Lock()
+	l.sweep(l.clock.Now(), true)
+	l.mu.Unlock()
+	if c, ok := l.handler.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
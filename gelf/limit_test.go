@@ -0,0 +1,111 @@
+package gelf
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"goutils/gelf/gelftest"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newLimitedLog(opts ...LimiterOption) (*Log, *memoryHandler, *Limiter, *fakeClock) {
+	memory := &memoryHandler{}
+	c := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := newLimiter(memory, c, opts...)
+	log := New("")
+	log.SetLevel(DEBUG)
+	log.AddHandlers(limiter)
+	return log, memory, limiter, c
+}
+
+func TestLimiterRate(t *testing.T) {
+	log, memory, limiter, c := newLimitedLog(WithRateLimit(2, 3), WithLevelRateLimit(ERROR, 0, 1))
+	for i := 0; i < 5; i++ {
+		log.Info(fmt.Sprint("burst ", i))
+	}
+	log.Error("error 1")
+	log.Error("error 2")
+	// Two tokens per second
+	c.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		log.Info(fmt.Sprint("refill ", i))
+	}
+	log.Debug("own bucket")
+
+	expected := "[INFO:burst 0 INFO:burst 1 INFO:burst 2 ERROR:error 1 INFO:refill 0 INFO:refill 1 DEBUG:own bucket]"
+	if got := fmt.Sprint(memory.messages()); got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if limiter.Dropped() != 4 || log.Dropped()["memory"] != 4 {
+		t.Errorf("expected 4 dropped records, got %d", limiter.Dropped())
+	}
+}
+
+func TestLimiterDedup(t *testing.T) {
+	log, memory, _, c := newLimitedLog(WithDedup(10 * time.Second))
+	for i := 0; i < 4; i++ {
+		log.Errorw("db down", "attempt", i)
+		c.Add(time.Second)
+	}
+	log.Error("other")
+	c.Add(7 * time.Second)
+	// The window of "db down" is over, its summary comes before the new record
+	log.Error("db down")
+	log.Warn("db down")
+
+	expected := "[ERROR:db down ERROR:other ERROR:db down ERROR:db down WARN:db down]"
+	if got := fmt.Sprint(memory.messages()); got != expected {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if fields := memory.records[2].Fields; fields[repeatedField] != 3 || fields["attempt"] != 3 {
+		t.Errorf("unexpected summary fields %v", fields)
+	}
+	if _, ok := memory.records[3].Fields[repeatedField]; ok {
+		t.Error("a new window must start without repeated")
+	}
+
+	log.Error("other")
+	if err := log.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if last := memory.records[len(memory.records)-1]; last.Message != "other" || last.Fields[repeatedField] != 1 {
+		t.Errorf("expected the summary of other after flush, got %+v", last)
+	}
+}
+
+func TestLimiterGELFRepeated(t *testing.T) {
+	server, err := gelftest.NewUDPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	log := New("")
+	limiter := NewLimiter(NewGELFHandler(server.Host(), server.Port()), WithDedup(time.Hour))
+	log.AddHandlers(limiter)
+	for i := 0; i < 100; i++ {
+		log.Error("hot loop")
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := server.WaitMessages(2, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := messages[0].Extra["_repeated"]; ok || messages[1].Extra["_repeated"] != int64(99) {
+		t.Errorf("unexpected messages %+v", messages)
+	}
+}
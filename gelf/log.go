@@ -1,11 +1,14 @@
 package gelf
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,104 +19,421 @@ const (
 	INFO
 	WARN
 	ERROR
+	PANIC
+	FATAL
 	timeFormat = "2006/1/2 15:04:05.000"
 )
 
-var log *Log
+var levelNames = map[LogLevel]string{DEBUG: "DEBUG", INFO: "INFO", WARN: "WARN", ERROR: "ERROR", PANIC: "PANIC", FATAL: "FATAL"}
 
-func init() {
-	once := sync.Once{}
-	if log == nil {
-		once.Do(func() {
-			log = new(Log)
-			log.handlers = make(map[string]LogHandler)
-		})
+func (level LogLevel) String() string {
+	if name, ok := levelNames[level]; ok {
+		return name
 	}
+	return fmt.Sprintf("LogLevel(%d)", level)
+}
+
+// ParseLevel parses a level name case-insensitively, "warning" is accepted for WARN.
+func ParseLevel(name string) (LogLevel, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "WARNING" {
+		return WARN, nil
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return DEBUG, fmt.Errorf("gelf: unknown level %q", name)
+}
+
+// exit is replaced in tests
+var exit = os.Exit
+
+const exitFlushTimeout = 5 * time.Second
+
+// flusher is implemented by handlers that buffer records, e.g. GELFHTTPHandler.
+type flusher interface {
+	Flush() error
+}
+
+type dropper interface {
+	Dropped() uint64
+}
+
+// Record is a single log event, handlers must treat it as read-only.
+type Record struct {
+	Level   LogLevel
+	Time    time.Time
+	Message string
+	Logger  string
+	Caller  Caller
+	Fields  map[string]interface{}
+	// Err is the error passed with ErrorWithErr or Err, Stack the trace captured for it
+	Err   error
+	Stack string
+}
+
+type Caller struct {
+	File     string
+	Line     int
+	Function string
 }
 
 type LogHandler interface {
-	write(msg string)
+	write(r *Record)
 	name() string
+	enabled(r *Record) bool
+}
+
+var defaultLog = New("")
+
+// logCore is shared by a logger and the children created with With.
+type logCore struct {
+	level    uint32
+	stacks   uint32       // 1 when ERROR records carry the stacks of all goroutines
+	redactor atomic.Value // *redactor set by SetRedaction, nil when nothing is masked
+
+	mu        sync.Mutex
+	handlers  []LogHandler
+	snapshot  atomic.Value // []LogHandler, replaced on every change so logging needs no lock
+	async     bool
+	queueSize int
+	policy    OverflowPolicy
+}
+
+func (c *logCore) list() []LogHandler {
+	handlers, _ := c.snapshot.Load().([]LogHandler)
+	return handlers
+}
+
+// update publishes the handlers, c.mu must be held.
+func (c *logCore) update() {
+	handlers := make([]LogHandler, len(c.handlers))
+	copy(handlers, c.handlers)
+	c.snapshot.Store(handlers)
 }
 
 type Log struct {
-	level    LogLevel
-	handlers map[string]LogHandler
+	name       string
+	core       *logCore
+	fields     map[string]interface{}
+	callerSkip int
+	noCaller   bool
+}
+
+// New returns an independent logger with its own level and handlers,
+// name is sent to GELF as the _logger field.
+func New(name string) *Log {
+	return &Log{name: name, core: &logCore{}}
+}
+
+// Default returns the package logger.
+func Default() *Log {
+	return defaultLog
 }
 
+// NewLog returns the package logger.
+//
+// Deprecated: use Default, or New for a logger that does not share handlers with other packages.
 func NewLog() *Log {
-	if log == nil {
-		log = new(Log)
-		log.handlers = make(map[string]LogHandler)
-	}
-	return log
+	return defaultLog
+}
+
+func (l *Log) Name() string {
+	return l.name
 }
 
 func (l *Log) SetLevel(level LogLevel) {
-	l.level = level
+	atomic.StoreUint32(&l.core.level, uint32(level))
 }
 
-func (l *Log) AddHandlers(handlers []LogHandler) {
+func (l *Log) Level() LogLevel {
+	return LogLevel(atomic.LoadUint32(&l.core.level))
+}
+
+// AddHandlers adds handlers whose name is not registered yet, it is safe to call concurrently with logging.
+func (l *Log) AddHandlers(handlers ...LogHandler) {
+	c := l.core
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	for _, handler := range handlers {
-		if _, ok := l.handlers[handler.name()]; !ok {
-			l.handlers[handler.name()] = handler
+		if c.handler(handler.name()) != nil {
+			continue
+		}
+		if c.async {
+			handler = newAsyncHandler(handler, c.queueSize, c.policy)
 		}
+		c.handlers = append(c.handlers, handler)
 	}
+	c.update()
 }
 
-func (l *Log) Debug(msg string) {
-	if l.level <= DEBUG {
-		for _, handler := range l.handlers {
-			handler.write(msg)
+// handler returns the handler registered as name, c.mu must be held.
+func (c *logCore) handler(name string) LogHandler {
+	for _, handler := range c.handlers {
+		if handler.name() == name {
+			return handler
 		}
 	}
+	return nil
 }
 
-func (l *Log) Info(msg string) {
-	if l.level <= INFO {
-		for _, handler := range l.handlers {
-			handler.write(msg)
+// SetAsync runs every handler, including the ones added later, on its own goroutine
+// behind a queue of queueSize records. policy decides what happens when a queue is full.
+func (l *Log) SetAsync(queueSize int, policy OverflowPolicy) {
+	c := l.core
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.async = true
+	c.queueSize = queueSize
+	c.policy = policy
+	for i, handler := range c.handlers {
+		if _, ok := handler.(*asyncHandler); !ok {
+			c.handlers[i] = newAsyncHandler(handler, queueSize, policy)
 		}
 	}
+	c.update()
 }
 
-func (l *Log) Warn(msg string) {
-	if l.level <= WARN {
-		for _, handler := range l.handlers {
-			handler.write(msg)
+// Flush waits until the async queues are drained and flushes handlers that buffer records.
+func (l *Log) Flush(ctx context.Context) error {
+	var firstErr error
+	for _, handler := range l.core.list() {
+		var err error
+		switch h := handler.(type) {
+		case *asyncHandler:
+			err = h.Flush(ctx)
+		case flusher:
+			err = h.Flush()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close drains the async queues, stops their workers and closes handlers that implement io.Closer.
+func (l *Log) Close() error {
+	var firstErr error
+	for _, handler := range l.core.list() {
+		if a, ok := handler.(*asyncHandler); ok {
+			a.Close()
+			handler = a.handler
+		}
+		if c, ok := handler.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
 		}
 	}
+	return firstErr
+}
+
+// Dropped returns the number of records each handler lost, e.g. because its async queue,
+// its spool or its Limiter was full.
+func (l *Log) Dropped() map[string]uint64 {
+	dropped := make(map[string]uint64)
+	for _, handler := range l.core.list() {
+		name := handler.name()
+		// Count the wrapper and every handler it wraps
+		for ; handler != nil; handler = unwrap(handler) {
+			if d, ok := handler.(dropper); ok {
+				dropped[name] += d.Dropped()
+			}
+		}
+	}
+	return dropped
+}
+
+// unwrap returns the handler wrapped by an async handler or a Limiter, or nil.
+func unwrap(handler LogHandler) LogHandler {
+	switch h := handler.(type) {
+	case *asyncHandler:
+		return h.handler
+	case *Limiter:
+		return h.handler
+	}
+	return nil
+}
+
+// With returns a child logger that adds the key/value pairs to every record,
+// the child shares level and handlers with l.
+func (l *Log) With(keysAndValues ...interface{}) *Log {
+	child := *l
+	child.fields = mergeFields(l.fields, keysAndValues)
+	return &child
+}
+
+// AddCallerSkip returns a child logger that reports the caller n frames further up,
+// for libraries that wrap Log in their own logging functions.
+func (l *Log) AddCallerSkip(n int) *Log {
+	child := *l
+	child.callerSkip += n
+	return &child
+}
+
+// WithoutCaller returns a child logger whose records carry neither the caller nor a stack trace,
+// for records that describe another program, e.g. lines forwarded from its output.
+func (l *Log) WithoutCaller() *Log {
+	child := *l
+	child.noCaller = true
+	return &child
+}
+
+func (l *Log) Debug(msg string) {
+	l.log(DEBUG, msg, nil)
+}
+
+func (l *Log) Info(msg string) {
+	l.log(INFO, msg, nil)
+}
+
+func (l *Log) Warn(msg string) {
+	l.log(WARN, msg, nil)
 }
 
 func (l *Log) Error(msg string) {
-	if l.level <= ERROR {
-		for _, handler := range l.handlers {
-			handler.write(msg)
+	l.log(ERROR, msg, nil)
+}
+
+// Debugw logs msg with structured key/value pairs, e.g. Debugw("login", "user", id, "latency", d).
+func (l *Log) Debugw(msg string, keysAndValues ...interface{}) {
+	l.log(DEBUG, msg, keysAndValues)
+}
+
+func (l *Log) Infow(msg string, keysAndValues ...interface{}) {
+	l.log(INFO, msg, keysAndValues)
+}
+
+func (l *Log) Warnw(msg string, keysAndValues ...interface{}) {
+	l.log(WARN, msg, keysAndValues)
+}
+
+func (l *Log) Errorw(msg string, keysAndValues ...interface{}) {
+	l.log(ERROR, msg, keysAndValues)
+}
+
+// Logw logs msg at level with key/value pairs, PANIC and FATAL records neither panic nor exit.
+func (l *Log) Logw(level LogLevel, msg string, keysAndValues ...interface{}) {
+	l.log(level, msg, keysAndValues)
+}
+
+func (l *Log) Debugf(format string, args ...interface{}) {
+	l.log(DEBUG, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Log) Infof(format string, args ...interface{}) {
+	l.log(INFO, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Log) Warnf(format string, args ...interface{}) {
+	l.log(WARN, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Log) Errorf(format string, args ...interface{}) {
+	l.log(ERROR, fmt.Sprintf(format, args...), nil)
+}
+
+// Panic logs msg and then panics with msg, even if PANIC is below the log level.
+func (l *Log) Panic(msg string) {
+	l.log(PANIC, msg, nil)
+	panic(msg)
+}
+
+func (l *Log) Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	l.log(PANIC, msg, nil)
+	panic(msg)
+}
+
+// Fatal logs msg, flushes every handler and exits the process with status 1.
+func (l *Log) Fatal(msg string) {
+	l.log(FATAL, msg, nil)
+	l.flushBeforeExit()
+	exit(1)
+}
+
+func (l *Log) Fatalf(format string, args ...interface{}) {
+	l.log(FATAL, fmt.Sprintf(format, args...), nil)
+	l.flushBeforeExit()
+	exit(1)
+}
+
+// callerDepth skips runtime.Callers, caller, Log.log and the exported logging method.
+const callerDepth = 4
+
+func caller(skip int) Caller {
+	pcs := make([]uintptr, 1)
+	if runtime.Callers(skip, pcs) == 0 {
+		return Caller{}
+	}
+	frame, _ := runtime.CallersFrames(pcs).Next()
+	return Caller{File: frame.File, Line: frame.Line, Function: frame.Function}
+}
+
+func (l *Log) flushBeforeExit() {
+	ctx, cancel := context.WithTimeout(context.Background(), exitFlushTimeout)
+	defer cancel()
+	if err := l.Flush(ctx); err != nil {
+		fmt.Println("Flush handler error ", err)
+	}
+}
+
+// log must be called directly by the exported logging methods, the caller is
+// taken callerDepth frames up plus the frames added with AddCallerSkip.
+func (l *Log) log(level LogLevel, msg string, keysAndValues []interface{}) {
+	if level < l.Level() {
+		return
+	}
+	err, keysAndValues := extractErr(keysAndValues)
+	r := &Record{Level: level, Time: time.Now(), Message: msg, Logger: l.name, Fields: mergeFields(l.fields, keysAndValues), Err: err}
+	if !l.noCaller {
+		r.Caller = caller(callerDepth + l.callerSkip)
+		if level >= ERROR {
+			r.Stack = l.stack(err, callerDepth+l.callerSkip)
+		}
+	}
+	l.dispatch(r)
+}
+
+// dispatch writes r to every handler that accepts it, the level of l is not checked.
+func (l *Log) dispatch(r *Record) {
+	if rd, _ := l.core.redactor.Load().(*redactor); rd != nil {
+		rd.redact(r)
+	}
+	for _, handler := range l.core.list() {
+		if handler.enabled(r) {
+			handler.write(r)
 		}
 	}
 }
 
 type ConsoleHandler struct {
+	baseHandler
+	mu        sync.Mutex
+	formatter Formatter
 }
 
+// NewConsoleHandler writes text to stdout, with colors when stdout is a terminal.
 func NewConsoleHandler() *ConsoleHandler {
-	return &ConsoleHandler{}
+	return &ConsoleHandler{formatter: &TextFormatter{Color: IsTerminal(os.Stdout)}}
 }
 
 func (c *ConsoleHandler) name() string {
 	return "console"
 }
 
-func (c *ConsoleHandler) write(msg string) {
-	_formatMsg := c.formatMsg(msg)
-	_, _ = os.Stdout.Write([]byte(_formatMsg))
+// SetFormatter replaces the default TextFormatter, e.g. with a JSONFormatter for Kubernetes.
+func (c *ConsoleHandler) SetFormatter(formatter Formatter) {
+	c.mu.Lock()
+	c.formatter = formatter
+	c.mu.Unlock()
 }
 
-func (c *ConsoleHandler) formatMsg(msg string) string {
-	logTime := time.Now().Format(timeFormat)
-	_, _file, line, _ := runtime.Caller(2)
-	_vars := strings.Split(_file, "/")
-	file := _vars[len(_vars)-1]
-	_msg := fmt.Sprintf("%v [%v:%v] %v\n", logTime, file, line, msg)
-	return _msg
+func (c *ConsoleHandler) write(r *Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _ = os.Stdout.Write(c.formatter.Format(r))
 }
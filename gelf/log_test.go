@@ -1,18 +1,365 @@
 package gelf
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"goutils/gelf/gelftest"
 )
 
+func newGELFTestLog(t *testing.T, name string) (*Log, *gelftest.Server) {
+	server, err := gelftest.NewUDPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := New(name)
+	log.AddHandlers(NewGELFHandler(server.Host(), server.Port()))
+	return log, server
+}
+
 func TestNewLog(t *testing.T) {
+	server, err := gelftest.NewUDPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	// NewLog returns the package logger, give this test a fresh one
+	defer func(previous *Log) { defaultLog = previous }(defaultLog)
+	defaultLog = New("")
 	log := NewLog()
 	log.SetLevel(DEBUG)
 	console := NewConsoleHandler()
-	gelf := NewGELFHandler("128.0.255.10", 12201)
+	gelf := NewGELFHandler(server.Host(), server.Port())
 	gelf.AddProperty("source", "test")
 	log.AddHandlers(console)
 	log.AddHandlers(console, gelf)
 	msg := `test msg`
 	log.Info("test from msg on gelf")
 	log.Info(msg)
+
+	messages, err := server.WaitMessages(2, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages[0].ShortMessage != "test from msg on gelf" || messages[1].ShortMessage != msg {
+		t.Errorf("unexpected messages %+v", messages)
+	}
+	if messages[1].Extra["_source"] != "test" || messages[1].Level != syslogInfo {
+		t.Errorf("unexpected fields %+v", messages[1])
+	}
+}
+
+func TestLogConcurrentLevels(t *testing.T) {
+	log, server := newGELFTestLog(t, "")
+	defer server.Close()
+
+	levels := map[LogLevel]func(string){DEBUG: log.Debug, INFO: log.Info, WARN: log.Warn, ERROR: log.Error}
+	const perLevel = 25
+	var wg sync.WaitGroup
+	for level, logFunc := range levels {
+		wg.Add(1)
+		go func(level LogLevel, logFunc func(string)) {
+			defer wg.Done()
+			for i := 0; i < perLevel; i++ {
+				logFunc(fmt.Sprintf("%d", syslogLevel(level)))
+			}
+		}(level, logFunc)
+	}
+	wg.Wait()
+
+	messages, err := server.WaitMessages(perLevel*len(levels), 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range messages {
+		if fmt.Sprint(message.Level) != message.ShortMessage {
+			t.Fatalf("message %v carries level %v", message.ShortMessage, message.Level)
+		}
+	}
+}
+
+func TestLogStructuredFields(t *testing.T) {
+	log, server := newGELFTestLog(t, "")
+	defer server.Close()
+
+	child := log.With("user", "tom", "request", 7)
+	child.Infow("login", "latency", "3ms", "user", "jerry")
+	log.Info("plain")
+
+	messages, err := server.WaitMessages(2, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extra := messages[0].Extra; extra["_user"] != "jerry" || extra["_request"] != int64(7) || extra["_latency"] != "3ms" {
+		t.Errorf("unexpected fields %v", extra)
+	}
+	if _, ok := messages[1].Extra["_user"]; ok {
+		t.Error("child fields leaked into the parent logger")
+	}
+}
+
+func TestMergeFieldsOddArgs(t *testing.T) {
+	fields := mergeFields(nil, []interface{}{"a", 1, 2, "b", "dangling"})
+	if fields["a"] != 1 || fields["2"] != "b" || fields[badKey] != "dangling" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if mergeFields(nil, nil) != nil {
+		t.Error("expected nil fields")
+	}
+}
+
+type memoryHandler struct {
+	baseHandler
+	mu      sync.Mutex
+	records []*Record
+	flushed int
+}
+
+func (m *memoryHandler) name() string {
+	return "memory"
+}
+
+func (m *memoryHandler) write(r *Record) {
+	m.mu.Lock()
+	m.records = append(m.records, r)
+	m.mu.Unlock()
+}
+
+func (m *memoryHandler) Flush() error {
+	m.mu.Lock()
+	m.flushed++
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memoryHandler) messages() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []string
+	for _, r := range m.records {
+		messages = append(messages, r.Level.String()+":"+r.Message)
+	}
+	return messages
+}
+
+func newMemoryLog() (*Log, *memoryHandler) {
+	memory := &memoryHandler{}
+	log := New("")
+	log.AddHandlers(memory)
+	return log, memory
+}
+
+func TestLogSetLevel(t *testing.T) {
+	tests := []struct {
+		level    LogLevel
+		expected []string
+	}{
+		{DEBUG, []string{"DEBUG:d 1", "INFO:i 2", "WARN:w 3", "ERROR:e 4"}},
+		{INFO, []string{"INFO:i 2", "WARN:w 3", "ERROR:e 4"}},
+		{WARN, []string{"WARN:w 3", "ERROR:e 4"}},
+		{ERROR, []string{"ERROR:e 4"}},
+		{FATAL, nil},
+	}
+	for _, tt := range tests {
+		log, memory := newMemoryLog()
+		log.SetLevel(tt.level)
+		log.Debugf("d %d", 1)
+		log.Infof("i %d", 2)
+		log.Warnf("w %d", 3)
+		log.Errorf("e %d", 4)
+		if got := memory.messages(); fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("level %v: expected %v, got %v", tt.level, tt.expected, got)
+		}
+	}
+}
+
+func TestLogPanic(t *testing.T) {
+	log, memory := newMemoryLog()
+	defer func() {
+		if recovered := recover(); recovered != "boom 1" {
+			t.Errorf("unexpected panic value %v", recovered)
+		}
+		if got := memory.messages(); len(got) != 1 || got[0] != "PANIC:boom 1" {
+			t.Errorf("unexpected records %v", got)
+		}
+	}()
+	log.Panicf("boom %d", 1)
+}
+
+func TestLogFatal(t *testing.T) {
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	log, memory := newMemoryLog()
+	log.Fatal("bye")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if got := memory.messages(); len(got) != 1 || got[0] != "FATAL:bye" || memory.flushed != 1 {
+		t.Errorf("unexpected records %v, flushed %d", got, memory.flushed)
+	}
+	if syslogLevel(FATAL) != syslogAlert || syslogLevel(PANIC) != syslogCritical {
+		t.Error("unexpected syslog severity for FATAL or PANIC")
+	}
+}
+
+func TestIndependentLogs(t *testing.T) {
+	first, firstMemory := newMemoryLog()
+	second, secondMemory := newMemoryLog()
+	first.SetLevel(ERROR)
+	second.SetLevel(DEBUG)
+	first.Info("first info")
+	first.Error("first error")
+	second.Debug("second debug")
+	if got := fmt.Sprint(firstMemory.messages()); got != "[ERROR:first error]" {
+		t.Errorf("unexpected records in first logger %v", got)
+	}
+	if got := fmt.Sprint(secondMemory.messages()); got != "[DEBUG:second debug]" {
+		t.Errorf("unexpected records in second logger %v", got)
+	}
+	if Default() != NewLog() || Default() == New("") {
+		t.Error("Default must return the package logger")
+	}
+}
+
+func TestLogConcurrentAddHandlers(t *testing.T) {
+	log, memory := newMemoryLog()
+	child := log.With("child", true)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			handler := &memoryHandler{}
+			log.AddHandlers(namedHandler{handler, fmt.Sprint("memory-", i)})
+		}(i)
+		go func() {
+			defer wg.Done()
+			child.Info("concurrent")
+			log.SetLevel(DEBUG)
+		}()
+	}
+	wg.Wait()
+	if len(log.core.list()) != 9 {
+		t.Errorf("expected 9 handlers, got %d", len(log.core.list()))
+	}
+	if len(memory.messages()) != 8 {
+		t.Errorf("expected 8 records, got %d", len(memory.messages()))
+	}
+}
+
+func TestLogNameField(t *testing.T) {
+	log, server := newGELFTestLog(t, "db")
+	defer server.Close()
+	log.Info("query")
+	messages, err := server.WaitMessages(1, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages[0].Extra["_logger"] != "db" {
+		t.Errorf("expected _logger db, got %v", messages[0].Extra["_logger"])
+	}
+}
+
+type namedHandler struct {
+	LogHandler
+	handlerName string
+}
+
+func (n namedHandler) name() string {
+	return n.handlerName
+}
+
+func logThroughHelper(log *Log, msg string) {
+	log.AddCallerSkip(1).Infow(msg)
+}
+
+func TestLogCallerSkip(t *testing.T) {
+	log, memory := newMemoryLog()
+	_, file, line, _ := runtime.Caller(0)
+	log.Info("direct")
+	logThroughHelper(log, "through helper")
+	func() {
+		defer func() { _ = recover() }()
+		log.Panic("panic")
+	}()
+
+	expected := []int{line + 1, line + 2, line + 5}
+	for i, r := range memory.records {
+		if r.Caller.File != file || r.Caller.Line != expected[i] {
+			t.Errorf("%v: expected %v:%d, got %v:%d", r.Message, file, expected[i], r.Caller.File, r.Caller.Line)
+		}
+		if !strings.HasSuffix(r.Caller.Function, "TestLogCallerSkip") && !strings.Contains(r.Caller.Function, "TestLogCallerSkip.func") {
+			t.Errorf("%v: unexpected function %v", r.Message, r.Caller.Function)
+		}
+	}
+}
+
+func TestGELFCallerFields(t *testing.T) {
+	log, server := newGELFTestLog(t, "")
+	defer server.Close()
+	_, file, line, _ := runtime.Caller(0)
+	log.Info("caller")
+	messages, err := server.WaitMessages(1, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := messages[0].Extra
+	if extra["_file"] != file || extra["_line"] != int64(line+1) || extra["_function"] != "goutils/gelf.TestGELFCallerFields" {
+		t.Errorf("unexpected caller fields %v %v %v", extra["_file"], extra["_line"], extra["_function"])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]LogLevel{"debug": DEBUG, "Info": INFO, "WARNING": WARN, "warn": WARN, " error ": ERROR, "fatal": FATAL} {
+		if level, err := ParseLevel(name); err != nil || level != expected {
+			t.Errorf("%q: expected %v, got %v %v", name, expected, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestGELFFieldsKeepStandardFields(t *testing.T) {
+	log, server := newGELFTestLog(t, "")
+	defer server.Close()
+	log.With("version", "2.3.0").Infow("hi", "host", "db1", "full_message", "details")
+	messages, err := server.WaitMessages(1, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := messages[0]
+	host, _ := os.Hostname()
+	if m.Version != "1.1" || m.Host != host || m.FullMessage != "" {
+		t.Errorf("record fields replaced standard fields %+v", m)
+	}
+	if m.Extra["_version"] != "2.3.0" || m.Extra["_host"] != "db1" || m.Extra["_full_message"] != "details" {
+		t.Errorf("expected prefixed fields, got %v", m.Extra)
+	}
+}
+
+func TestGELFFieldValues(t *testing.T) {
+	log, server := newGELFTestLog(t, "")
+	defer server.Close()
+	log.Errorw("x", "err", errors.New("connection refused"), "callback", func() {}, "ratio", math.NaN(),
+		"count", 3, "tags", []string{"a", "b"})
+	messages, err := server.WaitMessages(1, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := messages[0]
+	if m.Extra["_err"] != "connection refused" || m.Extra["_ratio"] != "NaN" || m.Extra["_count"] != int64(3) || m.Extra["_tags"] != "[a b]" {
+		t.Errorf("unexpected fields %v", m.Extra)
+	}
+	if callback, ok := m.Extra["_callback"].(string); !ok || !strings.HasPrefix(callback, "0x") {
+		t.Errorf("expected the func as a string, got %v", m.Extra["_callback"])
+	}
 }
@@ -0,0 +1,197 @@
+package gelf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// redactMask replaces every secret.
+const redactMask = "***"
+
+var (
+	// Query parameters such as the DingTalk webhook ?access_token=...&sign=...
+	accessTokenPattern = regexp.MustCompile(`(?i)[?&](?:access_token|token|sign)=([^&\s#"']+)`)
+	bearerPattern      = regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`)
+	passwordPattern    = regexp.MustCompile(`(?i)\b(?:password|passwd|pwd)"?\s*[=:]\s*"?([^\s"&,;]+)`)
+	phonePattern       = regexp.MustCompile(`(?:\+?86[- ]?)?\b1[3-9]\d{9}\b|\+[1-9]\d{7,14}\b`)
+
+	// DefaultRedactPatterns masks access tokens in URLs, bearer tokens, passwords and phone numbers.
+	DefaultRedactPatterns = []*regexp.Regexp{accessTokenPattern, bearerPattern, passwordPattern, phonePattern}
+	// DefaultRedactFields are field names whose values are always masked.
+	DefaultRedactFields = []string{"password", "passwd", "secret", "token", "access_token", "authorization", "api_key"}
+)
+
+// redactor masks secrets in records before they are dispatched to the handlers.
+type redactor struct {
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+}
+
+type RedactOption func(*redactor)
+
+// RedactFields masks the whole value of fields with these names, compared case-insensitively.
+func RedactFields(names ...string) RedactOption {
+	return func(rd *redactor) {
+		for _, name := range names {
+			rd.fields[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// RedactPatterns masks the matches of patterns in the message, the errors and the field values,
+// values that are not strings, maps or slices are masked in their fmt.Sprint form.
+// When a pattern has a group only the first group is masked, e.g. the value of a parameter.
+func RedactPatterns(patterns ...*regexp.Regexp) RedactOption {
+	return func(rd *redactor) {
+		rd.patterns = append(rd.patterns, patterns...)
+	}
+}
+
+// RedactDefaults adds DefaultRedactFields and DefaultRedactPatterns.
+func RedactDefaults() RedactOption {
+	return func(rd *redactor) {
+		RedactFields(DefaultRedactFields...)(rd)
+		RedactPatterns(DefaultRedactPatterns...)(rd)
+	}
+}
+
+// SetRedaction masks secrets in every record before any handler sees it, e.g.
+// log.SetRedaction(gelf.RedactDefaults(), gelf.RedactFields("card")). It replaces the
+// previous setting and no options turn redaction off. The setting is shared with child loggers.
+func (l *Log) SetRedaction(opts ...RedactOption) {
+	if len(opts) == 0 {
+		l.core.redactor.Store((*redactor)(nil))
+		return
+	}
+	rd := &redactor{fields: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(rd)
+	}
+	l.core.redactor.Store(rd)
+}
+
+// redact masks r in place, the record is not shared before dispatch.
+func (rd *redactor) redact(r *Record) {
+	r.Message = rd.text(r.Message)
+	for key, value := range r.Fields {
+		r.Fields[key] = rd.field(key, value)
+	}
+	if r.Err != nil {
+		r.Err = rd.err(r.Err)
+	}
+}
+
+// field masks value, maps and slices are copied so the caller's values are not changed.
+func (rd *redactor) field(key string, value interface{}) interface{} {
+	if rd.fields[strings.ToLower(key)] {
+		return redactMask
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return rd.text(v)
+	case error:
+		return rd.err(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = rd.field(k, item)
+		}
+		return m
+	case map[string]string:
+		m := make(map[string]string, len(v))
+		for k, item := range v {
+			m[k] = rd.field(k, item).(string)
+		}
+		return m
+	case map[string][]string:
+		m := make(map[string][]string, len(v))
+		for k, items := range v {
+			m[k] = rd.stringSlice(k, items)
+		}
+		return m
+	case []string:
+		return rd.stringSlice(key, v)
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = rd.field(key, item)
+		}
+		return s
+	}
+	// fmt.Stringer values such as *url.URL and everything else are masked in their printed
+	// form, values without secrets keep their type
+	printed := fmt.Sprint(value)
+	if masked := rd.text(printed); masked != printed {
+		return masked
+	}
+	return value
+}
+
+func (rd *redactor) stringSlice(key string, values []string) []string {
+	masked := make([]string, len(values))
+	for i, value := range values {
+		masked[i] = rd.field(key, value).(string)
+	}
+	return masked
+}
+
+func (rd *redactor) text(s string) string {
+	for _, pattern := range rd.patterns {
+		s = maskMatches(pattern, s)
+	}
+	return s
+}
+
+func maskMatches(pattern *regexp.Regexp, s string) string {
+	matches := pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if len(match) >= 4 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(redactMask)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// redactedError keeps the chain of a masked error, so _error still lists every wrapped error.
+type redactedError struct {
+	msg     string
+	wrapped error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.wrapped
+}
+
+// err returns err unchanged when nothing in its chain is a secret.
+func (rd *redactor) err(err error) error {
+	chain := errorChain(err)
+	if rd.text(chain) == chain {
+		return err
+	}
+	return rd.maskChain(err)
+}
+
+func (rd *redactor) maskChain(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{msg: rd.text(err.Error()), wrapped: rd.maskChain(errors.Unwrap(err))}
+}
@@ -0,0 +1,110 @@
+//go:build go1.21
+
+package gelf
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// SlogHandler is a slog.Handler that writes into the handlers of a Log,
+// attrs become record fields and groups prefix their keys with "group.".
+type SlogHandler struct {
+	log    *Log
+	fields map[string]interface{}
+	prefix string
+}
+
+func NewSlogHandler(l *Log) *SlogHandler {
+	return &SlogHandler{log: l}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return fromSlogLevel(level) >= h.log.Level()
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, sr slog.Record) error {
+	r := &Record{
+		Level:   fromSlogLevel(sr.Level),
+		Time:    sr.Time,
+		Message: sr.Message,
+		Logger:  h.log.name,
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if sr.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{sr.PC}).Next()
+		r.Caller = Caller{File: frame.File, Line: frame.Line, Function: frame.Function}
+	}
+	// Context pairs come first so attrs override them
+	fields := mergeFields(h.log.fields, contextFields(ctx, nil))
+	if fields == nil {
+		fields = make(map[string]interface{}, len(h.fields)+sr.NumAttrs())
+	}
+	for key, value := range h.fields {
+		fields[key] = value
+	}
+	sr.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.prefix, a)
+		return true
+	})
+	if len(fields) > 0 {
+		r.Fields = fields
+	}
+	h.log.dispatch(r)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := *h
+	child.fields = make(map[string]interface{}, len(h.fields)+len(attrs))
+	for key, value := range h.fields {
+		child.fields[key] = value
+	}
+	for _, a := range attrs {
+		addAttr(child.fields, h.prefix, a)
+	}
+	return &child
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	child := *h
+	child.prefix = h.prefix + name + "."
+	return &child
+}
+
+func addAttr(fields map[string]interface{}, prefix string, a slog.Attr) {
+	value := a.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = prefix + a.Key + "."
+		}
+		for _, member := range value.Group() {
+			addAttr(fields, groupPrefix, member)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	fields[prefix+a.Key] = value.Any()
+}
+
+func fromSlogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return DEBUG
+	case level < slog.LevelWarn:
+		return INFO
+	case level < slog.LevelError:
+		return WARN
+	}
+	return ERROR
+}
@@ -0,0 +1,55 @@
+//go:build go1.21
+
+package gelf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	log, memory := newMemoryLog()
+	log.SetLevel(INFO)
+	logger := slog.New(NewSlogHandler(log.With("service", "api")))
+	child := logger.With("version", 2).WithGroup("req")
+
+	_, file, line, _ := runtime.Caller(0)
+	logger.Debug("skipped")
+	child.Warn("slow", "id", 7, slog.Group("db", "table", "users"), "err", errors.New("timeout"))
+	logger.Log(context.Background(), slog.LevelError+4, "fatal-ish")
+
+	if got := fmt.Sprint(memory.messages()); got != "[WARN:slow ERROR:fatal-ish]" {
+		t.Fatalf("unexpected records %v", got)
+	}
+	r := memory.records[0]
+	expected := map[string]interface{}{"service": "api", "version": int64(2), "req.id": int64(7), "req.db.table": "users"}
+	for key, value := range expected {
+		if r.Fields[key] != value {
+			t.Errorf("%v: expected %v, got %v", key, value, r.Fields[key])
+		}
+	}
+	if err, ok := r.Fields["req.err"].(error); !ok || err.Error() != "timeout" {
+		t.Errorf("unexpected error field %v", r.Fields["req.err"])
+	}
+	if r.Caller.File != file || r.Caller.Line != line+2 {
+		t.Errorf("unexpected caller %v:%d", r.Caller.File, r.Caller.Line)
+	}
+}
+
+func TestSlogHandlerContext(t *testing.T) {
+	log, memory := newMemoryLog()
+	logger := slog.New(NewSlogHandler(log))
+	ctx := ContextWithTrace(context.Background(), "trace-1", "")
+	logger.InfoContext(ctx, "traced", "trace_id", "attr wins")
+	logger.InfoContext(ctx, "traced")
+	if got := memory.records[0].Fields["trace_id"]; got != "attr wins" {
+		t.Errorf("expected the attr to override the context, got %v", got)
+	}
+	if fields := memory.records[1].Fields; fields["trace_id"] != "trace-1" || fields["span_id"] != nil {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
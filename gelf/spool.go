@@ -0,0 +1,298 @@
+package gelf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = time.Minute
+	// Every message on disk is prefixed with its length
+	spoolHeaderSize = 4
+)
+
+// spool keeps payloads that could not be sent, in order. The newest payloads go to
+// the file once the memory ring is full, and stay there until the file is replayed.
+type spool struct {
+	mu       sync.Mutex
+	ring     [][]byte
+	ringSize int
+	path     string
+	file     *os.File
+	maxDisk  int64
+	diskSize int64
+	offset   int64
+	dropped  uint64
+}
+
+func newSpool(path string, ringSize int, maxDisk int64) (*spool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	// Payloads left by a previous run are replayed first
+	return &spool{ringSize: ringSize, path: path, file: file, maxDisk: maxDisk, diskSize: info.Size()}, nil
+}
+
+func (s *spool) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ring) == 0 && s.offset == s.diskSize
+}
+
+func (s *spool) push(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.offset == s.diskSize && len(s.ring) < s.ringSize {
+		s.ring = append(s.ring, data)
+		return
+	}
+	if s.maxDisk > 0 && s.diskSize+int64(spoolHeaderSize+len(data)) > s.maxDisk {
+		s.dropped++
+		return
+	}
+	entry := spoolEntry(data)
+	if _, err := s.file.WriteAt(entry, s.diskSize); err != nil {
+		fmt.Println("Write spool file error ", err)
+		s.dropped++
+		return
+	}
+	s.diskSize += int64(len(entry))
+}
+
+func spoolEntry(data []byte) []byte {
+	entry := make([]byte, spoolHeaderSize+len(data))
+	binary.BigEndian.PutUint32(entry, uint32(len(data)))
+	copy(entry[spoolHeaderSize:], data)
+	return entry
+}
+
+// peek returns the oldest payload without removing it.
+func (s *spool) peek() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.ring) > 0 {
+		return s.ring[0], nil
+	}
+	if s.offset == s.diskSize {
+		return nil, io.EOF
+	}
+	header := make([]byte, spoolHeaderSize)
+	if _, err := s.file.ReadAt(header, s.offset); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := s.file.ReadAt(data, s.offset+spoolHeaderSize); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// pop removes the payload returned by peek.
+func (s *spool) pop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.ring) > 0 {
+		s.ring[0] = nil
+		s.ring = s.ring[1:]
+		return
+	}
+	header := make([]byte, spoolHeaderSize)
+	if _, err := s.file.ReadAt(header, s.offset); err != nil {
+		s.reset()
+		return
+	}
+	s.offset += spoolHeaderSize + int64(binary.BigEndian.Uint32(header))
+	if s.offset >= s.diskSize {
+		s.reset()
+	}
+}
+
+// reset empties the file once it is replayed, s.mu must be held.
+func (s *spool) reset() {
+	if err := s.file.Truncate(0); err != nil {
+		fmt.Println("Truncate spool file error ", err)
+	}
+	s.offset = 0
+	s.diskSize = 0
+}
+
+// persist moves the memory ring in front of the file, so the next run replays everything in order.
+func (s *spool) persist() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.ring) == 0 && s.offset == 0 {
+		return nil
+	}
+	rest := make([]byte, s.diskSize-s.offset)
+	if _, err := s.file.ReadAt(rest, s.offset); err != nil && err != io.EOF {
+		return err
+	}
+	var content []byte
+	for _, data := range s.ring {
+		content = append(content, spoolEntry(data)...)
+	}
+	content = append(content, rest...)
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.file.WriteAt(content, 0); err != nil {
+		return err
+	}
+	s.ring = nil
+	s.offset = 0
+	s.diskSize = int64(len(content))
+	return s.file.Sync()
+}
+
+func (s *spool) close() error {
+	err := s.persist()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WithSpool keeps messages that could not be sent in a ring of memSize messages, which
+// overflows to a spool file in dir of at most maxDiskBytes, 0 means unlimited. A background
+// loop reconnects with exponential backoff and replays them in order.
+func WithSpool(dir string, memSize int, maxDiskBytes int64) GELFOption {
+	return func(g *GELFHandler) {
+		g.spoolDir = dir
+		g.spoolMemSize = memSize
+		g.spoolMaxDisk = maxDiskBytes
+	}
+}
+
+// WithReconnectBackoff sets the first and the longest wait between reconnect attempts of the spool.
+func WithReconnectBackoff(min, max time.Duration) GELFOption {
+	return func(g *GELFHandler) {
+		g.minBackoff = min
+		g.maxBackoff = max
+	}
+}
+
+func (g *GELFHandler) startSpool() {
+	path := filepath.Join(g.spoolDir, fmt.Sprintf("gelf-%v-%v.spool", g.server, g.port))
+	s, err := newSpool(path, g.spoolMemSize, g.spoolMaxDisk)
+	if err != nil {
+		fmt.Println("Open spool file error ", err)
+		return
+	}
+	g.spool = s
+	g.wakeup = make(chan struct{}, 1)
+	g.done = make(chan struct{})
+	g.stopped = make(chan struct{})
+	go g.replayLoop()
+	if !s.empty() {
+		g.wake()
+	}
+}
+
+func (g *GELFHandler) wake() {
+	select {
+	case g.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue spools data when it cannot be sent now, g.mu must be held.
+func (g *GELFHandler) enqueue(data []byte) {
+	g.spool.push(data)
+	g.wake()
+}
+
+func (g *GELFHandler) replayLoop() {
+	defer close(g.stopped)
+	backoff := g.minBackoff
+	for {
+		select {
+		case <-g.wakeup:
+		case <-g.done:
+			return
+		}
+		for !g.replay() {
+			select {
+			case <-time.After(backoff):
+			case <-g.done:
+				return
+			}
+			if backoff *= 2; backoff > g.maxBackoff {
+				backoff = g.maxBackoff
+			}
+		}
+		backoff = g.minBackoff
+	}
+}
+
+// replay sends the spooled messages in order, it reports whether the spool is empty.
+func (g *GELFHandler) replay() bool {
+	for {
+		data, err := g.spool.peek()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			fmt.Println("Read spool file error ", err)
+			g.spool.pop()
+			continue
+		}
+		g.mu.Lock()
+		err = g.send(data)
+		g.mu.Unlock()
+		if err != nil && err != ErrMessageTooLarge {
+			return false
+		}
+		g.spool.pop()
+	}
+}
+
+// Dropped returns the number of messages lost because the spool was full.
+func (g *GELFHandler) Dropped() uint64 {
+	if g.spool == nil {
+		return 0
+	}
+	g.spool.mu.Lock()
+	defer g.spool.mu.Unlock()
+	return g.spool.dropped
+}
+
+// Flush writes the spooled messages that are still in memory to the spool file, so they are
+// replayed by the next run when the process exits before Graylog is back, e.g. after Fatal.
+func (g *GELFHandler) Flush() error {
+	if g.spool == nil {
+		return nil
+	}
+	return g.spool.persist()
+}
+
+// Close stops the spool loop, messages that are still spooled stay on disk for the next run.
+func (g *GELFHandler) Close() error {
+	if g.spool != nil {
+		g.closeOnce.Do(func() {
+			close(g.done)
+		})
+		<-g.stopped
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.close()
+	if g.spool == nil {
+		return nil
+	}
+	return g.spool.close()
+}
@@ -0,0 +1,187 @@
+package gelf
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// freePort returns a local TCP port that nothing listens on.
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+	return port
+}
+
+func TestGELFHandlerSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	port := freePort(t)
+	gelf := NewGELFHandler("127.0.0.1", port,
+		WithTransport(TransportTCP),
+		WithSpool(dir, 2, 1<<20),
+		WithReconnectBackoff(5*time.Millisecond, 20*time.Millisecond),
+	)
+	defer gelf.Close()
+
+	for i := 0; i < 5; i++ {
+		gelf.write(testRecord(INFO, fmt.Sprint(i)))
+	}
+	info, err := os.Stat(filepath.Join(dir, fmt.Sprintf("gelf-127.0.0.1-%d.spool", port)))
+	if err != nil || info.Size() == 0 {
+		t.Fatalf("expected messages in the spool file, got %v", err)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	gelf.write(testRecord(INFO, "5"))
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 6; i++ {
+		frame, err := reader.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var property map[string]interface{}
+		if err := json.Unmarshal(frame[:len(frame)-1], &property); err != nil {
+			t.Fatal(err)
+		}
+		if property["short_message"] != fmt.Sprint(i) {
+			t.Fatalf("expected message %d, got %v", i, property["short_message"])
+		}
+	}
+	if gelf.Dropped() != 0 {
+		t.Errorf("expected no dropped messages, got %d", gelf.Dropped())
+	}
+}
+
+func TestGELFHandlerSpoolLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gelf := NewGELFHandler("127.0.0.1", freePort(t),
+		WithTransport(TransportTCP),
+		WithSpool(dir, 1, 300),
+		WithReconnectBackoff(time.Hour, time.Hour),
+	)
+	for i := 0; i < 5; i++ {
+		gelf.write(testRecord(INFO, fmt.Sprint(i)))
+	}
+	// One message in memory, the file holds as many as fit in 300 bytes
+	if dropped := gelf.Dropped(); dropped == 0 || dropped == 4 {
+		t.Errorf("expected the spool file to be limited, got %d dropped", dropped)
+	}
+	if err := gelf.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolCloseKeepsOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.spool")
+	s, err := newSpool(path, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		s.push([]byte(fmt.Sprint(i)))
+	}
+	// Replay the first memory message, then stop
+	s.pop()
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = newSpool(path, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	var replayed []string
+	for {
+		data, err := s.peek()
+		if err != nil {
+			break
+		}
+		replayed = append(replayed, string(data))
+		s.pop()
+	}
+	if fmt.Sprint(replayed) != "[1 2 3]" {
+		t.Errorf("expected [1 2 3] after restart, got %v", replayed)
+	}
+}
+
+func TestGELFHandlerSpoolFatal(t *testing.T) {
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	port := freePort(t)
+	gelf := NewGELFHandler("127.0.0.1", port,
+		WithTransport(TransportTCP),
+		WithSpool(dir, 100, 0),
+		WithReconnectBackoff(time.Hour, time.Hour),
+	)
+	defer gelf.Close()
+	log := New("")
+	log.AddHandlers(gelf)
+	log.Info("first")
+	log.Fatal("dying")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+
+	// The next run replays the spool file
+	s, err := newSpool(filepath.Join(dir, fmt.Sprintf("gelf-127.0.0.1-%d.spool", port)), 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	var replayed []interface{}
+	for {
+		data, err := s.peek()
+		if err != nil {
+			break
+		}
+		var property map[string]interface{}
+		if err := json.Unmarshal(data, &property); err != nil {
+			t.Fatal(err)
+		}
+		replayed = append(replayed, property["short_message"])
+		s.pop()
+	}
+	if len(replayed) != 2 || replayed[0] != "first" || replayed[1] != "dying" {
+		t.Errorf("unexpected spooled messages %v", replayed)
+	}
+}
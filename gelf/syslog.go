@@ -0,0 +1,282 @@
+package gelf
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Facility int
+
+const (
+	FacilityKern   Facility = 0
+	FacilityUser   Facility = 1
+	FacilityDaemon Facility = 3
+	FacilityAuth   Facility = 4
+	FacilityLocal0 Facility = 16
+	FacilityLocal1 Facility = 17
+	FacilityLocal2 Facility = 18
+	FacilityLocal3 Facility = 19
+	FacilityLocal4 Facility = 20
+	FacilityLocal5 Facility = 21
+	FacilityLocal6 Facility = 22
+	FacilityLocal7 Facility = 23
+)
+
+type SyslogFormat int
+
+const (
+	RFC5424 SyslogFormat = iota
+	RFC3164
+)
+
+const (
+	rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+	rfc3164Time = "Jan _2 15:04:05"
+	// SD-ID of the record fields, 32473 is the enterprise number reserved for examples
+	defaultStructuredDataID = "fields@32473"
+	maxParamNameLength      = 32
+	nilValue                = "-"
+)
+
+// SyslogHandler sends records to a syslog daemon over UDP, TCP or a Unix socket.
+type SyslogHandler struct {
+	baseHandler
+	network  string
+	addr     string
+	format   SyslogFormat
+	facility Facility
+	appName  string
+	hostname string
+	sdID     string
+	pid      string
+
+	mu   sync.Mutex
+	conn net.Conn
+	// stream is set for a Unix stream socket, where messages end with a newline
+	stream bool
+}
+
+type SyslogOption func(*SyslogHandler)
+
+// WithFacility sets the facility of all messages, the default is FacilityUser.
+func WithFacility(facility Facility) SyslogOption {
+	return func(s *SyslogHandler) {
+		s.facility = facility
+	}
+}
+
+// WithAppName sets APP-NAME (the TAG in RFC 3164), the default is the program name.
+func WithAppName(name string) SyslogOption {
+	return func(s *SyslogHandler) {
+		s.appName = name
+	}
+}
+
+// WithSyslogFormat selects RFC5424 (the default) or the BSD RFC3164 format.
+func WithSyslogFormat(format SyslogFormat) SyslogOption {
+	return func(s *SyslogHandler) {
+		s.format = format
+	}
+}
+
+// WithStructuredDataID sets the SD-ID that holds the record fields in RFC 5424 messages.
+func WithStructuredDataID(id string) SyslogOption {
+	return func(s *SyslogHandler) {
+		s.sdID = id
+	}
+}
+
+// NewSyslogHandler creates a handler that sends to addr over network, which is "udp", "tcp"
+// or "unix". TCP messages use octet-counting framing (RFC 6587), addr of "unix" is a socket
+// path such as /dev/log.
+func NewSyslogHandler(network, addr string, opts ...SyslogOption) *SyslogHandler {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = nilValue
+	}
+	s := &SyslogHandler{
+		network:  network,
+		addr:     addr,
+		facility: FacilityUser,
+		appName:  filepath.Base(os.Args[0]),
+		hostname: hostname,
+		sdID:     defaultStructuredDataID,
+		pid:      strconv.Itoa(os.Getpid()),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *SyslogHandler) name() string {
+	return "syslog"
+}
+
+func (s *SyslogHandler) write(r *Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var msg []byte
+	if s.format == RFC3164 {
+		msg = s.formatRFC3164(r)
+	} else {
+		msg = s.formatRFC5424(r)
+	}
+	if err := s.send(msg); err != nil {
+		fmt.Println("Send message to syslog error ", err)
+	}
+}
+
+func (s *SyslogHandler) priority(r *Record) int {
+	return int(s.facility)*8 + syslogLevel(r.Level)
+}
+
+// formatRFC5424 renders "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG".
+func (s *SyslogHandler) formatRFC5424(r *Record) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %v %v %v %v %v ", s.priority(r), r.Time.Format(rfc5424Time),
+		headerField(s.hostname, 255), headerField(s.appName, 48), s.pid, headerField(r.Logger, 32))
+	b.WriteString(s.structuredData(r))
+	b.WriteString(" ")
+	b.WriteString(r.Message)
+	return []byte(b.String())
+}
+
+// structuredData puts the fields, the caller and the error of r in one SD element.
+func (s *SyslogHandler) structuredData(r *Record) string {
+	params := make(map[string]interface{}, len(r.Fields)+2)
+	for key, value := range r.Fields {
+		params[key] = value
+	}
+	if caller := callerString(r.Caller); caller != "" {
+		params["caller"] = caller
+	}
+	if r.Err != nil {
+		params["error"] = errorChain(r.Err)
+	}
+	if len(params) == 0 {
+		return nilValue
+	}
+	var b strings.Builder
+	b.WriteString("[")
+	b.WriteString(s.sdID)
+	for _, key := range sortedKeys(params) {
+		b.WriteString(" ")
+		b.WriteString(paramName(key))
+		b.WriteString(`="`)
+		b.WriteString(paramValue(fmt.Sprint(params[key])))
+		b.WriteString(`"`)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// formatRFC3164 renders "<PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG key=value", which has no structured data.
+func (s *SyslogHandler) formatRFC3164(r *Record) []byte {
+	msg := fmt.Sprintf("<%d>%v %v %v[%v]: %v%v%v", s.priority(r), r.Time.Format(rfc3164Time),
+		s.hostname, s.appName, s.pid, r.Message, formatFields(r.Fields), formatErr(r))
+	return []byte(msg)
+}
+
+// headerField replaces what RFC 5424 does not allow in a header field, an empty value becomes "-".
+func headerField(value string, maxLength int) string {
+	if value == "" {
+		return nilValue
+	}
+	field := []byte(value)
+	for i, c := range field {
+		if c < 33 || c > 126 {
+			field[i] = '_'
+		}
+	}
+	if len(field) > maxLength {
+		field = field[:maxLength]
+	}
+	return string(field)
+}
+
+// paramName keeps PARAM-NAME to 32 printable characters without '=', ' ', ']' and '"'.
+func paramName(key string) string {
+	name := []byte(headerField(key, maxParamNameLength))
+	for i, c := range name {
+		if c == '=' || c == ']' || c == '"' {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// paramValue escapes '"', '\' and ']' as required in PARAM-VALUE.
+func paramValue(value string) string {
+	value = strings.ToValidUTF8(value, "\uFFFD")
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+func (s *SyslogHandler) send(msg []byte) error {
+	if err := s.connect(); err != nil {
+		return err
+	}
+	err := s.sendOnce(msg)
+	if err == nil {
+		return nil
+	}
+	// The daemon may have been restarted, dial again and retry once.
+	s.close()
+	if err := s.connect(); err != nil {
+		return err
+	}
+	return s.sendOnce(msg)
+}
+
+func (s *SyslogHandler) sendOnce(msg []byte) error {
+	if s.network == "tcp" {
+		// Octet counting: "MSG-LEN SP SYSLOG-MSG"
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	} else if s.stream {
+		msg = append(msg, '\n')
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+func (s *SyslogHandler) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+	var conn net.Conn
+	var err error
+	if s.network == "unix" {
+		// Local daemons listen on a datagram socket, some on a stream one
+		conn, err = net.DialTimeout("unixgram", s.addr, dialTimeout)
+		if s.stream = err != nil; s.stream {
+			conn, err = net.DialTimeout("unix", s.addr, dialTimeout)
+		}
+	} else {
+		conn, err = net.DialTimeout(s.network, s.addr, dialTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *SyslogHandler) close() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *SyslogHandler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.close()
+	return nil
+}
@@ -0,0 +1,123 @@
+package gelf
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogHandlerRFC5424(t *testing.T) {
+	conn, port := listenUDP(t)
+	defer conn.Close()
+	syslog := NewSyslogHandler("udp", "127.0.0.1:"+strconv.Itoa(port), WithFacility(FacilityLocal3), WithAppName("api"))
+	defer syslog.Close()
+
+	r := testRecord(WARN, "slow query")
+	r.Logger = "db"
+	r.Fields = map[string]interface{}{"table": "users", "sql": `select "x"]`, "bad key=": 1}
+	r.Err = errors.New("timeout")
+	syslog.write(r)
+	syslog.write(testRecord(INFO, "plain"))
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// local3 * 8 + warning
+	pattern := `^<156>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) \S+ api \d+ db ` +
+		`\[fields@32473 bad_key_="1" error="timeout" sql="select \\"x\\"\\]" table="users"\] slow query$`
+	if !regexp.MustCompile(pattern).Match(buf[:n]) {
+		t.Errorf("unexpected message %q", buf[:n])
+	}
+	if n, err = conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^<158>1 \S+ \S+ api \d+ - - plain$`).Match(buf[:n]) {
+		t.Errorf("unexpected message %q", buf[:n])
+	}
+}
+
+func TestSyslogHandlerTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	syslog := NewSyslogHandler("tcp", listener.Addr().String(), WithSyslogFormat(RFC3164), WithAppName("api"))
+	defer syslog.Close()
+	go func() {
+		syslog.write(testRecord(ERROR, "first"))
+		r := testRecord(DEBUG, "second")
+		r.Fields = map[string]interface{}{"user": "tom"}
+		syslog.write(r)
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	reader := bufio.NewReader(conn)
+	expected := []string{
+		`^<11>\w{3} [ \d]\d \d\d:\d\d:\d\d \S+ api\[\d+\]: first$`,
+		`^<15>\w{3} [ \d]\d \d\d:\d\d:\d\d \S+ api\[\d+\]: second user=tom$`,
+	}
+	for _, pattern := range expected {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Fatalf("expected an octet count, got %q", length)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(pattern).Match(msg) {
+			t.Errorf("unexpected message %q", msg)
+		}
+	}
+}
+
+func TestSyslogHandlerUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gelf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	log := New("")
+	syslog := NewSyslogHandler("unix", path, WithAppName("api"))
+	defer syslog.Close()
+	log.AddHandlers(syslog)
+	log.Info("local")
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^<14>1 \S+ \S+ api \d+ - \[fields@32473 caller="syslog_test.go:\d+"\] local$`).Match(buf[:n]) {
+		t.Errorf("unexpected message %q", buf[:n])
+	}
+}
@@ -0,0 +1,71 @@
+package gelf
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logWriter logs every line written to it, partial lines are kept until the newline arrives.
+type logWriter struct {
+	log   *Log
+	level LogLevel
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Writer returns an io.Writer that logs every line at level,
+// e.g. log.SetOutput(l.Writer(gelf.INFO)) sends the standard log package to l.
+func (l *Log) Writer(level LogLevel) io.Writer {
+	return &logWriter{log: l, level: level}
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.buf = append(w.buf, p...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	w.mu.Unlock()
+	if len(lines) == 0 || w.level < w.log.Level() {
+		return len(p), nil
+	}
+	c := writerCaller()
+	for _, line := range lines {
+		w.log.dispatch(&Record{
+			Level:   w.level,
+			Time:    time.Now(),
+			Message: line,
+			Logger:  w.log.name,
+			Caller:  c,
+			Fields:  mergeFields(w.log.fields, nil),
+		})
+	}
+	return len(p), nil
+}
+
+// writerCaller returns the first frame above Write outside of the standard log and fmt packages.
+func writerCaller() Caller {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log.") && !strings.HasPrefix(frame.Function, "fmt.") {
+			return Caller{File: frame.File, Line: frame.Line, Function: frame.Function}
+		}
+		if !more {
+			return Caller{}
+		}
+	}
+}
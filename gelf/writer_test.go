@@ -0,0 +1,31 @@
+package gelf
+
+import (
+	"fmt"
+	stdlog "log"
+	"runtime"
+	"testing"
+)
+
+func TestLogWriter(t *testing.T) {
+	log, memory := newMemoryLog()
+	std := stdlog.New(log.Writer(WARN), "", 0)
+	_, file, line, _ := runtime.Caller(0)
+	std.Printf("disk %d%% full", 91)
+	w := log.Writer(INFO)
+	_, _ = w.Write([]byte("partial "))
+	_, _ = w.Write([]byte("line\r\nsecond line\n"))
+
+	if got := fmt.Sprint(memory.messages()); got != "[WARN:disk 91% full INFO:partial line INFO:second line]" {
+		t.Fatalf("unexpected records %v", got)
+	}
+	if c := memory.records[0].Caller; c.File != file || c.Line != line+1 {
+		t.Errorf("unexpected caller %v:%d", c.File, c.Line)
+	}
+
+	log.SetLevel(ERROR)
+	std.Print("filtered")
+	if len(memory.messages()) != 3 {
+		t.Error("lines below the log level must be skipped")
+	}
+}